@@ -0,0 +1,83 @@
+package webterm
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// AdminHandler returns the HTTP handler of the administration API.
+// It has no authentication of its own, mount it behind the application's
+// access control and strip the mount prefix, e.g.
+//
+//	http.Handle("/admin/terminal/", http.StripPrefix("/admin/terminal", wt.AdminHandler()))
+//
+// Routes:
+//
+//	GET    /sessions               list the live sessions
+//	POST   /sessions/{id}/shares   create a share link, body {"ttl":"1h","readOnly":true}
+//	GET    /shares                 list the active shares
+//	DELETE /shares/{id}            revoke a share and disconnect its clients
+func (wt *WebTerm) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /sessions", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, wt.Sessions())
+	})
+	mux.HandleFunc("POST /sessions/{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			TTL      string `json:"ttl"`
+			ReadOnly bool   `json:"readOnly"`
+		}{}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSONError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+		ttl := time.Hour
+		if req.TTL != "" {
+			d, err := time.ParseDuration(req.TTL)
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, err)
+				return
+			}
+			ttl = d
+		}
+		share, err := wt.Share(r.PathValue("id"), ttl, req.ReadOnly)
+		if errors.Is(err, ErrSessionNotFound) {
+			writeJSONError(w, http.StatusNotFound, err)
+			return
+		} else if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err)
+			return
+		}
+		slog.Info("webterm share created", "session", share.SessionID, "share", share.ID, "expires", share.ExpiresAt, "readOnly", share.ReadOnly)
+		writeJSON(w, http.StatusCreated, share)
+	})
+	mux.HandleFunc("GET /shares", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, wt.Shares())
+	})
+	mux.HandleFunc("DELETE /shares/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := wt.RevokeShare(r.PathValue("id")); err != nil {
+			writeJSONError(w, http.StatusNotFound, err)
+			return
+		}
+		slog.Info("webterm share revoked", "share", r.PathValue("id"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("webterm failed to write response", "error", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,304 @@
+package webterm
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type AnsiKind int
+
+const (
+	AnsiText    AnsiKind = iota // printable text
+	AnsiControl                 // C0 control character, e.g. CR, LF, BS
+	AnsiEscape                  // ESC sequence, e.g. ESC 7, ESC M
+	AnsiCSI                     // Control Sequence Introducer, ESC [ ...
+	AnsiOSC                     // Operating System Command, ESC ] ... ST
+	AnsiDCS                     // DCS, SOS, PM and APC strings, ESC P ... ST
+	AnsiInvalid                 // aborted or unknown sequence, e.g. the first ESC of ESC ESC, in Raw
+)
+
+// AnsiToken is a single element of a terminal output stream.
+type AnsiToken struct {
+	Kind AnsiKind
+	// Data is the text for AnsiText and the payload of OSC/DCS strings
+	Data string
+	// Params holds the raw parameter bytes of CSI sequences, e.g. "1;31" or "?1049"
+	Params string
+	// Intermediate holds the intermediate bytes of ESC and CSI sequences
+	Intermediate string
+	// Final is the final byte of ESC/CSI, the control character of AnsiControl,
+	// or the introducer ('P', 'X', '^', '_') of AnsiDCS
+	Final byte
+	// Raw is the exact byte sequence of the token
+	Raw []byte
+}
+
+// Param returns the i-th numeric CSI parameter, or def if it is missing or zero.
+func (t AnsiToken) Param(i int, def int) int {
+	ps := t.IntParams()
+	if i < len(ps) && ps[i] > 0 {
+		return ps[i]
+	}
+	return def
+}
+
+// IntParams returns the numeric CSI parameters, missing values are 0.
+// A leading private marker such as '?' or '>' is ignored.
+func (t AnsiToken) IntParams() []int {
+	s := strings.TrimLeft(t.Params, "<=>?")
+	if s == "" {
+		return nil
+	}
+	fields := strings.Split(strings.ReplaceAll(s, ":", ";"), ";")
+	ret := make([]int, len(fields))
+	for i, f := range fields {
+		ret[i], _ = strconv.Atoi(f)
+	}
+	return ret
+}
+
+// Private reports whether the CSI sequence has a private marker, e.g. '?' in "?1049h".
+func (t AnsiToken) Private() byte {
+	if t.Params != "" && strings.IndexByte("<=>?", t.Params[0]) >= 0 {
+		return t.Params[0]
+	}
+	return 0
+}
+
+type ansiState int
+
+const (
+	ansiGround ansiState = iota
+	ansiEsc
+	ansiCSI
+	ansiString    // OSC, DCS, SOS, PM, APC payload
+	ansiStringEsc // ESC seen inside a string, expecting '\'
+)
+
+// maxAnsiString limits the payload of a single OSC/DCS string,
+// longer strings are discarded.
+const maxAnsiString = 4 << 20
+
+// AnsiParser splits a terminal output stream into AnsiTokens.
+// It keeps its state between calls of Feed, so sequences and UTF-8 characters
+// split across multiple writes are reassembled.
+// The Raw of the tokens is the stream as is, except for strings longer than maxAnsiString,
+// aborted sequences are AnsiInvalid tokens.
+type AnsiParser struct {
+	state    ansiState
+	kind     AnsiKind
+	intro    byte
+	raw      []byte
+	params   []byte
+	inter    []byte
+	data     []byte
+	overflow bool
+	pending  []byte // incomplete UTF-8 character at the end of the last Feed
+}
+
+// Feed parses p and calls fn for every complete token.
+// The token's byte slices are only valid during the call.
+func (ap *AnsiParser) Feed(p []byte, fn func(AnsiToken)) {
+	textStart := -1
+	flushText := func(end int) {
+		var text []byte
+		if textStart >= 0 {
+			text = p[textStart:end]
+			textStart = -1
+		}
+		if len(ap.pending) > 0 {
+			// an incomplete character of the last Feed is passed on as it is
+			text = append(ap.pending, text...)
+			ap.pending = ap.pending[:0]
+		}
+		if len(text) > 0 {
+			fn(AnsiToken{Kind: AnsiText, Data: string(text), Raw: text})
+		}
+	}
+	for i := 0; i < len(p); i++ {
+		b := p[i]
+		switch ap.state {
+		case ansiGround:
+			switch {
+			case b == 0x1b:
+				flushText(i)
+				ap.begin(b)
+				ap.state = ansiEsc
+			case b < 0x20 || b == 0x7f:
+				flushText(i)
+				fn(AnsiToken{Kind: AnsiControl, Final: b, Raw: p[i : i+1]})
+			default:
+				if textStart < 0 {
+					textStart = i
+				}
+			}
+		case ansiEsc:
+			ap.raw = append(ap.raw, b)
+			switch {
+			case b == 0x1b:
+				ap.invalid(ap.raw[:len(ap.raw)-1], fn)
+				ap.begin(b)
+			case b == 0x18 || b == 0x1a:
+				ap.abort(fn)
+			case b >= 0x20 && b <= 0x2f:
+				ap.inter = append(ap.inter, b)
+			case b == '[' && len(ap.inter) == 0:
+				ap.state = ansiCSI
+			case b == ']' && len(ap.inter) == 0:
+				ap.kind, ap.intro, ap.state = AnsiOSC, b, ansiString
+			case (b == 'P' || b == 'X' || b == '^' || b == '_') && len(ap.inter) == 0:
+				ap.kind, ap.intro, ap.state = AnsiDCS, b, ansiString
+			case b < 0x20:
+				// control characters are executed in the middle of a sequence
+				fn(AnsiToken{Kind: AnsiControl, Final: b, Raw: []byte{b}})
+				ap.raw = ap.raw[:len(ap.raw)-1]
+			default:
+				fn(AnsiToken{Kind: AnsiEscape, Intermediate: string(ap.inter), Final: b, Raw: ap.raw})
+				ap.state = ansiGround
+			}
+		case ansiCSI:
+			ap.raw = append(ap.raw, b)
+			switch {
+			case b == 0x1b:
+				ap.invalid(ap.raw[:len(ap.raw)-1], fn)
+				ap.begin(b)
+				ap.state = ansiEsc
+			case b == 0x18 || b == 0x1a:
+				ap.abort(fn)
+			case b >= 0x30 && b <= 0x3f:
+				ap.params = append(ap.params, b)
+			case b >= 0x20 && b <= 0x2f:
+				ap.inter = append(ap.inter, b)
+			case b >= 0x40 && b <= 0x7e:
+				fn(AnsiToken{Kind: AnsiCSI, Params: string(ap.params), Intermediate: string(ap.inter), Final: b, Raw: ap.raw})
+				ap.state = ansiGround
+			case b < 0x20:
+				fn(AnsiToken{Kind: AnsiControl, Final: b, Raw: []byte{b}})
+				ap.raw = ap.raw[:len(ap.raw)-1]
+			}
+		case ansiString:
+			switch {
+			case b == 0x1b:
+				ap.state = ansiStringEsc
+			case b == 0x07 && ap.kind == AnsiOSC:
+				ap.raw = append(ap.raw, b)
+				ap.emitString(fn)
+			case b == 0x18 || b == 0x1a:
+				ap.raw = append(ap.raw, b)
+				ap.abort(fn)
+			default:
+				ap.appendString(b)
+			}
+		case ansiStringEsc:
+			if b == '\\' {
+				ap.raw = append(ap.raw, 0x1b, b)
+				ap.emitString(fn)
+			} else {
+				// unterminated string followed by a new sequence
+				if !ap.overflow {
+					ap.invalid(ap.raw, fn)
+				}
+				ap.begin(0x1b)
+				ap.state = ansiEsc
+				i--
+			}
+		}
+	}
+	if textStart < 0 {
+		return
+	}
+	// hold back an incomplete UTF-8 character at the end of the buffer
+	text := p[textStart:]
+	if len(ap.pending) > 0 {
+		text = append(append([]byte(nil), ap.pending...), text...)
+	}
+	cut := incompleteRune(text)
+	if cut > len(p)-textStart {
+		ap.pending = append(ap.pending, p[textStart:]...)
+		return
+	}
+	flushText(len(p) - cut)
+	ap.pending = append(ap.pending, p[len(p)-cut:]...)
+}
+
+// incompleteRune returns the length of an incomplete UTF-8 encoding at the end of b.
+func incompleteRune(b []byte) int {
+	for k := 1; k <= utf8.UTFMax && k <= len(b); k++ {
+		c := b[len(b)-k]
+		if c < 0x80 {
+			return 0
+		}
+		if utf8.RuneStart(c) {
+			if utf8.FullRune(b[len(b)-k:]) {
+				return 0
+			}
+			return k
+		}
+	}
+	return 0
+}
+
+func (ap *AnsiParser) begin(esc byte) {
+	ap.raw = append(ap.raw[:0], esc)
+	ap.params = ap.params[:0]
+	ap.inter = ap.inter[:0]
+	ap.data = ap.data[:0]
+	ap.overflow = false
+}
+
+// invalid passes on the bytes of a sequence that did not complete
+func (ap *AnsiParser) invalid(raw []byte, fn func(AnsiToken)) {
+	if len(raw) > 0 {
+		fn(AnsiToken{Kind: AnsiInvalid, Raw: raw})
+	}
+}
+
+// abort ends the sequence at CAN or SUB, which is the last byte of raw
+func (ap *AnsiParser) abort(fn func(AnsiToken)) {
+	if !ap.overflow {
+		ap.invalid(ap.raw, fn)
+	}
+	ap.state = ansiGround
+}
+
+func (ap *AnsiParser) appendString(b byte) {
+	if ap.overflow {
+		return
+	}
+	if len(ap.data) >= maxAnsiString {
+		ap.overflow = true
+		return
+	}
+	ap.data = append(ap.data, b)
+	ap.raw = append(ap.raw, b)
+}
+
+func (ap *AnsiParser) emitString(fn func(AnsiToken)) {
+	ap.state = ansiGround
+	if ap.overflow {
+		return
+	}
+	fn(AnsiToken{Kind: ap.kind, Data: string(ap.data), Final: ap.intro, Raw: ap.raw})
+}
+
+// StripAnsi removes all escape sequences and control characters except
+// newline and tab from s. Unlike StripAnsiCodes, which only handles SGR
+// color codes, it understands cursor movement, OSC titles, DCS strings etc.
+func StripAnsi(s string) string {
+	var sb strings.Builder
+	var ap AnsiParser
+	ap.Feed([]byte(s), func(tok AnsiToken) {
+		switch tok.Kind {
+		case AnsiText:
+			sb.WriteString(tok.Data)
+		case AnsiControl:
+			if tok.Final == '\n' || tok.Final == '\t' {
+				sb.WriteByte(tok.Final)
+			}
+		}
+	})
+	// flush an incomplete trailing character as is
+	sb.Write(ap.pending)
+	return sb.String()
+}
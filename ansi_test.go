@@ -0,0 +1,120 @@
+package webterm
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStripAnsi(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"plain", "hello world", "hello world"},
+		{"sgr", "\x1b[1;31mred\x1b[0m text", "red text"},
+		{"cursor", "a\x1b[2Cb\x1b[Kc", "abc"},
+		{"private mode", "\x1b[?1049hfull\x1b[?1049l", "full"},
+		{"osc bel", "\x1b]0;title\x07prompt$ ", "prompt$ "},
+		{"osc st", "\x1b]7;file:///tmp\x1b\\prompt$ ", "prompt$ "},
+		{"dcs", "\x1bPq#0;2;0;0;0\x1b\\done", "done"},
+		{"escape", "\x1b7saved\x1b8", "saved"},
+		{"controls", "a\r\n\tb\x07\x08", "a\n\tb"},
+		{"utf8", "\x1b[32m한글\x1b[0m", "한글"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripAnsi(tt.input); got != tt.expected {
+				t.Errorf("StripAnsi(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAnsiParserSplit(t *testing.T) {
+	input := []byte("\x1b[38;5;208m한\x1b]2;my title\x1b\\x")
+	// feed the input one byte at a time, the result must be the same
+	var ap AnsiParser
+	var tokens []AnsiToken
+	for i := range input {
+		ap.Feed(input[i:i+1], func(tok AnsiToken) {
+			tok.Raw = append([]byte(nil), tok.Raw...)
+			tokens = append(tokens, tok)
+		})
+	}
+	if len(tokens) != 4 {
+		t.Fatalf("Expected 4 tokens, got %d: %+v", len(tokens), tokens)
+	}
+	if tokens[0].Kind != AnsiCSI || tokens[0].Final != 'm' || tokens[0].Params != "38;5;208" {
+		t.Errorf("Unexpected CSI token: %+v", tokens[0])
+	}
+	if ps := tokens[0].IntParams(); len(ps) != 3 || ps[2] != 208 {
+		t.Errorf("Unexpected CSI params: %v", ps)
+	}
+	if tokens[1].Kind != AnsiText || tokens[1].Data != "한" {
+		t.Errorf("Unexpected text token: %+v", tokens[1])
+	}
+	if tokens[2].Kind != AnsiOSC || tokens[2].Data != "2;my title" {
+		t.Errorf("Unexpected OSC token: %+v", tokens[2])
+	}
+	if string(tokens[2].Raw) != "\x1b]2;my title\x1b\\" {
+		t.Errorf("Unexpected OSC raw: %q", tokens[2].Raw)
+	}
+	if tokens[3].Kind != AnsiText || tokens[3].Data != "x" {
+		t.Errorf("Unexpected text token: %+v", tokens[3])
+	}
+}
+
+func TestAnsiTokenParams(t *testing.T) {
+	tok := AnsiToken{Kind: AnsiCSI, Params: "?1049", Final: 'h'}
+	if tok.Private() != '?' {
+		t.Errorf("Expected private marker '?', got %q", tok.Private())
+	}
+	if tok.Param(0, 1) != 1049 {
+		t.Errorf("Expected 1049, got %d", tok.Param(0, 1))
+	}
+	tok = AnsiToken{Kind: AnsiCSI, Params: ";5", Final: 'H'}
+	if tok.Param(0, 1) != 1 || tok.Param(1, 1) != 5 {
+		t.Errorf("Unexpected params: %d %d", tok.Param(0, 1), tok.Param(1, 1))
+	}
+}
+
+func TestAnsiParserPassthrough(t *testing.T) {
+	tests := []struct {
+		name   string
+		inputs []string // the writes of the stream
+		kinds  []AnsiKind
+	}{
+		{"esc esc", []string{"\x1b\x1b7"}, []AnsiKind{AnsiInvalid, AnsiEscape}},
+		{"esc in csi", []string{"\x1b[1\x1b[m"}, []AnsiKind{AnsiInvalid, AnsiCSI}},
+		{"can in csi", []string{"\x1b[1\x18m"}, []AnsiKind{AnsiInvalid, AnsiText}},
+		{"sub in esc", []string{"\x1b(\x1ab"}, []AnsiKind{AnsiInvalid, AnsiText}},
+		{"can in osc", []string{"\x1b]0;title\x18x"}, []AnsiKind{AnsiInvalid, AnsiText}},
+		{"unterminated osc", []string{"\x1b]0;title\x1b[m"}, []AnsiKind{AnsiInvalid, AnsiCSI}},
+		{"split esc esc", []string{"\x1b", "\x1b", "7"}, []AnsiKind{AnsiInvalid, AnsiEscape}},
+		{"utf8 tail before csi", []string{"a\xed\x95", "\x1b[m"}, []AnsiKind{AnsiText, AnsiText, AnsiCSI}},
+		{"utf8 tail before control", []string{"\xed\x95", "\r\n"}, []AnsiKind{AnsiText, AnsiControl, AnsiControl}},
+		{"utf8 tail completed", []string{"\xed\x95", "", "\x9c!"}, []AnsiKind{AnsiText}},
+		{"invalid lead bytes", []string{"\xed", "\xed", "x"}, []AnsiKind{AnsiText, AnsiText}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ap AnsiParser
+			var raw []byte
+			var kinds []AnsiKind
+			for _, in := range tt.inputs {
+				ap.Feed([]byte(in), func(tok AnsiToken) {
+					raw = append(raw, tok.Raw...)
+					kinds = append(kinds, tok.Kind)
+				})
+			}
+			if input := strings.Join(tt.inputs, ""); string(raw) != input {
+				t.Errorf("Expected the raw tokens %q, got %q", input, raw)
+			}
+			if !slices.Equal(kinds, tt.kinds) {
+				t.Errorf("Expected the tokens %v, got %v", tt.kinds, kinds)
+			}
+		})
+	}
+}
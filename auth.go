@@ -0,0 +1,36 @@
+package webterm
+
+import (
+	"net/http"
+	"slices"
+)
+
+// Principal is the authenticated user of a session.
+type Principal struct {
+	Name  string   `json:"name,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+func (p Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+// Authenticator resolves the principal of a request,
+// the request is rejected with 401 Unauthorized if it returns an error.
+type Authenticator func(r *http.Request) (Principal, error)
+
+// WithAuthenticator sets the Authenticator of new sessions and exports.
+// Clients attaching with a share token are not authenticated, the token is their credential.
+// Without an Authenticator all sessions belong to the anonymous principal.
+func WithAuthenticator(auth Authenticator) Option {
+	return func(wt *WebTerm) {
+		wt.authenticator = auth
+	}
+}
+
+func (wt *WebTerm) authenticate(r *http.Request) (Principal, error) {
+	if wt.authenticator == nil {
+		return Principal{}, nil
+	}
+	return wt.authenticator(r)
+}
@@ -0,0 +1,70 @@
+package webterm
+
+import (
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// BroadcastTarget is a terminal of the broadcast page
+type BroadcastTarget struct {
+	Name string `json:"name"`
+	// URL of the WebTerm page of the target, e.g. "/ssh/web1/".
+	// A share link such as "/ssh/web1/?share=<token>" attaches to a live session.
+	URL string `json:"url"`
+}
+
+// Broadcast serves a cluster-ssh style page: the targets are shown side by side
+// and the input pane sends the same keystrokes to every target whose input is not muted.
+// Each target is a session of its own WebTerm, typing into a target pane reaches only that target.
+type Broadcast struct {
+	page
+	targets []BroadcastTarget
+}
+
+// NewBroadcast returns the handler of the broadcast page of the targets.
+// The options of the page are the ones of WebTerm, WithCutPrefix, WithTheme, WithFontFamily, WithFontSize,
+// WithScrollback and WithLocalization, the others are ignored.
+// The query "?targets=web1,web2" selects a group of the targets by name.
+func NewBroadcast(targets []BroadcastTarget, opts ...Option) *Broadcast {
+	return &Broadcast{page: pageOf(opts), targets: targets}
+}
+
+var tmplBroadcast *template.Template
+
+func (b *Broadcast) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, b.cutPrefix)
+	switch path {
+	case "":
+		b.index(w, r)
+	default:
+		serveStatic(w, r, path)
+	}
+}
+
+func (b *Broadcast) index(w http.ResponseWriter, r *http.Request) {
+	if tmplBroadcast == nil {
+		if data, err := staticFS.ReadFile("static/broadcast.html"); err != nil {
+			http.Error(w, "Failed to read broadcast.html", http.StatusInternalServerError)
+			return
+		} else {
+			tmplBroadcast = template.Must(template.New("broadcast").Parse(string(data)))
+		}
+	}
+	targets := b.targets
+	if sel := r.URL.Query().Get("targets"); sel != "" {
+		names := strings.Split(sel, ",")
+		targets = slices.DeleteFunc(slices.Clone(targets), func(t BroadcastTarget) bool {
+			return !slices.Contains(names, t.Name)
+		})
+	}
+	tmplData := TemplateData{
+		Terminal:     b.terminalOptions,
+		Localization: b.localization,
+		Ext:          targets,
+	}
+	if err := tmplBroadcast.Execute(w, tmplData); err != nil {
+		http.Error(w, "Failed to render broadcast.html", http.StatusInternalServerError)
+	}
+}
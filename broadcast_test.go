@@ -0,0 +1,60 @@
+package webterm
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBroadcastPage(t *testing.T) {
+	b := NewBroadcast([]BroadcastTarget{
+		{Name: "web1", URL: "/ssh/web1/"},
+		{Name: "web2", URL: "/ssh/web2/"},
+		{Name: "db1", URL: "/ssh/db1/"},
+	}, WithCutPrefix("/fleet/"), WithLocalization(map[string]string{"Mute input": "Stumm"}))
+	srv := httptest.NewServer(b)
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		rsp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rsp.Body.Close()
+		body, _ := io.ReadAll(rsp.Body)
+		return rsp.StatusCode, string(body)
+	}
+	code, body := get("/fleet/")
+	if code != http.StatusOK {
+		t.Fatalf("Expected the broadcast page, got %d %s", code, body)
+	}
+	for _, expect := range []string{`"url":"/ssh/web1/"`, `"name":"db1"`, `"Stumm"`} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("Expected %s in the page", expect)
+		}
+	}
+	_, body = get("/fleet/?targets=web1,web2")
+	if !strings.Contains(body, `"name":"web2"`) || strings.Contains(body, `"name":"db1"`) {
+		t.Errorf("Expected only the selected targets")
+	}
+	if code, _ := get("/fleet/webterm.js"); code != http.StatusOK {
+		t.Errorf("Expected static files, got %d", code)
+	}
+	if code, _ := get("/fleet/broadcast.html"); code != http.StatusNotFound {
+		t.Errorf("Expected the template to be hidden, got %d", code)
+	}
+
+	// the terminal pages do not serve the template either
+	wt := httptest.NewServer(New(echoRunner{}, WithCutPrefix("/ssh/")))
+	defer wt.Close()
+	rsp, err := http.Get(wt.URL + "/ssh/broadcast.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the broadcast template to be hidden by WebTerm, got %d", rsp.StatusCode)
+	}
+}
@@ -0,0 +1,104 @@
+package webterm
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"strings"
+)
+
+// ClipboardMode decides what happens with the OSC 52 clipboard requests of a session
+type ClipboardMode string
+
+const (
+	ClipboardDeny  ClipboardMode = "deny"
+	ClipboardAllow ClipboardMode = "allow"
+	ClipboardAsk   ClipboardMode = "ask" // the browser asks the user every time
+)
+
+// ClipboardPolicy controls the OSC 52 clipboard access of the sessions,
+// e.g. copying from tmux or vim to the clipboard of the browser.
+// Only the owner of a session gets clipboard requests, guests attached with a share link never do.
+type ClipboardPolicy struct {
+	Write ClipboardMode `json:"write,omitempty"` // the session sets the clipboard, deny if empty
+	Read  ClipboardMode `json:"read,omitempty"`  // the session reads the clipboard, deny if empty
+	// MaxSize is the largest clipboard write in bytes, DefaultClipboardMaxSize if zero
+	MaxSize int `json:"maxSize,omitempty"`
+}
+
+const DefaultClipboardMaxSize = 1 << 20
+
+// WithClipboard enables OSC 52 clipboard support with the policy.
+// The OSC 52 sequences are removed from the output, and the allowed requests
+// are sent to the browser as "clipboard" events.
+// Without it the sequences reach the browser's terminal, which ignores them.
+func WithClipboard(policy ClipboardPolicy) Option {
+	return func(wt *WebTerm) {
+		if policy.MaxSize <= 0 {
+			policy.MaxSize = DefaultClipboardMaxSize
+		}
+		wt.clipboard = &policy
+	}
+}
+
+// clipboardEvent is sent to the owner of the session for an allowed OSC 52 request.
+// For "read" the browser answers with an OSC 52 sequence as input.
+type clipboardEvent struct {
+	Op        string `json:"op"` // "write" or "read"
+	Selection string `json:"selection,omitempty"`
+	Text      string `json:"text,omitempty"`
+	Ask       bool   `json:"ask,omitempty"`
+}
+
+// clipboardFilter removes the OSC 52 sequences from the output
+type clipboardFilter struct {
+	policy ClipboardPolicy
+	parser AnsiParser
+	buf    []byte
+}
+
+// filter returns p without OSC 52 sequences and calls fn for the allowed requests.
+// The returned slice is valid until the next call.
+func (cf *clipboardFilter) filter(p []byte, fn func(clipboardEvent)) []byte {
+	cf.buf = cf.buf[:0]
+	cf.parser.Feed(p, func(tok AnsiToken) {
+		if tok.Kind == AnsiOSC && strings.HasPrefix(tok.Data, "52;") {
+			if evt, ok := cf.request(tok.Data[3:]); ok {
+				fn(evt)
+			}
+			return
+		}
+		cf.buf = append(cf.buf, tok.Raw...)
+	})
+	return cf.buf
+}
+
+// request applies the policy to the OSC 52 arguments "<selection>;<base64 data or ?>"
+func (cf *clipboardFilter) request(arg string) (clipboardEvent, bool) {
+	sel, data, ok := strings.Cut(arg, ";")
+	if !ok {
+		return clipboardEvent{}, false
+	}
+	if data == "?" {
+		if cf.policy.Read != ClipboardAllow && cf.policy.Read != ClipboardAsk {
+			return clipboardEvent{}, false
+		}
+		return clipboardEvent{Op: "read", Selection: sel, Ask: cf.policy.Read == ClipboardAsk}, true
+	}
+	if cf.policy.Write != ClipboardAllow && cf.policy.Write != ClipboardAsk {
+		return clipboardEvent{}, false
+	}
+	if base64.StdEncoding.DecodedLen(len(data)) > cf.policy.MaxSize+2 {
+		slog.Warn("webterm clipboard write too large", "size", base64.StdEncoding.DecodedLen(len(data)), "max", cf.policy.MaxSize)
+		return clipboardEvent{}, false
+	}
+	text, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(text) > cf.policy.MaxSize {
+		return clipboardEvent{}, false
+	}
+	return clipboardEvent{Op: "write", Selection: sel, Text: string(text), Ask: cf.policy.Write == ClipboardAsk}, true
+}
+
+// sendClipboard queues the clipboard request to the owner, it is called with ls.mu held.
+func (ls *liveSession) sendClipboard(evt clipboardEvent) {
+	ls.pending = append(ls.pending, eventMessage("clipboard", evt, true))
+}
@@ -0,0 +1,112 @@
+package webterm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestClipboardFilter(t *testing.T) {
+	b64 := base64.StdEncoding.EncodeToString
+	tests := []struct {
+		policy ClipboardPolicy
+		input  string
+		expect string // event
+	}{
+		{ClipboardPolicy{Write: ClipboardAllow}, "\x1b]52;c;" + b64([]byte("hello")) + "\x07", "write c hello false"},
+		{ClipboardPolicy{Write: ClipboardAsk}, "\x1b]52;c;" + b64([]byte("hello")) + "\x1b\\", "write c hello true"},
+		{ClipboardPolicy{}, "\x1b]52;c;" + b64([]byte("hello")) + "\x07", ""},
+		{ClipboardPolicy{Write: ClipboardAllow, MaxSize: 4}, "\x1b]52;c;" + b64([]byte("hello")) + "\x07", ""},
+		{ClipboardPolicy{Write: ClipboardAllow}, "\x1b]52;c;!!!\x07", ""},
+		{ClipboardPolicy{Write: ClipboardAllow}, "\x1b]52;c;?\x07", ""},
+		{ClipboardPolicy{Read: ClipboardAllow}, "\x1b]52;p;?\x07", "read p  false"},
+		{ClipboardPolicy{Read: ClipboardAsk}, "\x1b]52;c;?\x07", "read c  true"},
+	}
+	for i, tt := range tests {
+		if tt.policy.MaxSize == 0 {
+			tt.policy.MaxSize = DefaultClipboardMaxSize
+		}
+		cf := &clipboardFilter{policy: tt.policy}
+		var events []string
+		out := cf.filter([]byte("a"+tt.input+"b"), func(evt clipboardEvent) {
+			events = append(events, strings.Join([]string{evt.Op, evt.Selection, evt.Text, map[bool]string{true: "true", false: "false"}[evt.Ask]}, " "))
+		})
+		if string(out) != "ab" {
+			t.Errorf("case %d: expected the sequence to be removed, got %q", i, out)
+		}
+		if got := strings.Join(events, ","); got != tt.expect {
+			t.Errorf("case %d: expected event %q, got %q", i, tt.expect, got)
+		}
+	}
+
+	// other sequences pass through, a sequence split across writes is reassembled
+	cf := &clipboardFilter{policy: ClipboardPolicy{Write: ClipboardAllow, MaxSize: DefaultClipboardMaxSize}}
+	var out []byte
+	var text string
+	for _, p := range []string{"\x1b[31mred\x1b]0;title\x07\x1b]5", "2;c;aGk=", "\x07é\r\n"} {
+		out = append(out, cf.filter([]byte(p), func(evt clipboardEvent) { text = evt.Text })...)
+	}
+	if string(out) != "\x1b[31mred\x1b]0;title\x07é\r\n" || text != "hi" {
+		t.Errorf("Unexpected output %q and clipboard %q", out, text)
+	}
+}
+
+func TestClipboardEvent(t *testing.T) {
+	wt := New(echoRunner{}, WithCutPrefix("/"), WithClipboard(ClipboardPolicy{Write: ClipboardAllow}))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	conn := dialData(t, srv, "")
+	defer conn.Close()
+	info := readEvent(t, conn)
+	share, _ := wt.Share(info.ID, time.Minute, false)
+	guest := dialData(t, srv, "?share="+share.Token)
+	defer guest.Close()
+	readEvent(t, guest)
+
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01x\x1b]52;c;aGk=\x07y"))
+	var output strings.Builder
+	var clip *clipboardEvent
+	for clip == nil || output.Len() < 2 {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		mt, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected output and clipboard event, got %q %v", output.String(), err)
+		}
+		if mt == websocket.BinaryMessage {
+			output.Write(msg)
+			continue
+		}
+		evt := struct {
+			Type string         `json:"type"`
+			Data clipboardEvent `json:"data"`
+		}{}
+		if json.Unmarshal(msg, &evt); evt.Type == "clipboard" {
+			clip = &evt.Data
+		}
+	}
+	if output.String() != "xy" || clip.Text != "hi" {
+		t.Errorf("Unexpected output %q and clipboard %+v", output.String(), clip)
+	}
+
+	// the guest gets the output but not the clipboard
+	var guestOutput strings.Builder
+	for !strings.Contains(guestOutput.String(), "xy") {
+		guest.SetReadDeadline(time.Now().Add(2 * time.Second))
+		mt, msg, err := guest.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected guest output, got %q %v", guestOutput.String(), err)
+		}
+		if mt == websocket.TextMessage && strings.Contains(string(msg), `"clipboard"`) {
+			t.Errorf("Guest received a clipboard event")
+		}
+		if mt == websocket.BinaryMessage {
+			guestOutput.Write(msg)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -8,6 +9,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/OutOfBedlam/webterm"
 	"github.com/OutOfBedlam/webterm/webport"
 )
 
@@ -52,9 +54,22 @@ func serveCommand(fs *flag.FlagSet, args []string) {
 	// flag -L [local_ip:]local_port:remote_ip:remote_port if local_ip is omitted, bind to all interfaces
 	var portFlags PortVar
 	fs.Var(&portFlags, "L", "Local port forwarding, [local_ip:]local_port:remote_ip:remote_port")
+	var tlsOpts webterm.TLSOptions
+	fs.StringVar(&tlsOpts.CertFile, "tls-cert", "", "TLS certificate file of the local ports")
+	fs.StringVar(&tlsOpts.KeyFile, "tls-key", "", "TLS key file of the local ports")
+	fs.BoolVar(&tlsOpts.SelfSigned, "tls-self-signed", false, "Serve TLS with a generated self-signed certificate")
+	fs.StringVar(&tlsOpts.ClientCAFile, "tls-client-ca", "", "Require client certificates signed by the CAs in this PEM file")
 	if err := fs.Parse(args); err != nil {
 		panic(err)
 	}
+	var tlsConfig *tls.Config
+	if tlsOpts.CertFile != "" || tlsOpts.KeyFile != "" || tlsOpts.SelfSigned || tlsOpts.ClientCAFile != "" {
+		cfg, err := tlsOpts.Config()
+		if err != nil {
+			panic(fmt.Sprintf("invalid tls options: %v", err))
+		}
+		tlsConfig = cfg
+	}
 
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})))
 
@@ -64,8 +79,14 @@ func serveCommand(fs *flag.FlagSet, args []string) {
 		if err != nil {
 			panic(err)
 		}
+		localIP := addrBind.LocalIP
+		if localIP == "" {
+			localIP = "0.0.0.0"
+		}
 		var sc webport.Config
-		sc.LocalAddr = addrBind.String()
+		sc.LocalAddr = fmt.Sprintf("tcp://%s:%d", localIP, addrBind.LocalPort)
+		sc.RemoteAddr = fmt.Sprintf("tcp://%s:%d", addrBind.RemoteIP, addrBind.RemotePort)
+		sc.TLS = tlsConfig
 		srv, err := webport.New(sc)
 		if err != nil {
 			panic(fmt.Sprintf("failed to create server: %v", err))
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/OutOfBedlam/webterm/webclient"
+	"github.com/gorilla/websocket"
+	"golang.org/x/term"
+)
+
+// detachKey ends the attach command without sending the key, like telnet's escape
+const detachKey = 0x1d // Ctrl-]
+
+func attachCommand(fs *flag.FlagSet, args []string) {
+	header := http.Header{}
+	fs.Func("H", "Header of the request, e.g. \"Authorization: Bearer <token>\" (repeatable)", func(s string) error {
+		name, value, ok := strings.Cut(s, ":")
+		if !ok {
+			return errors.New("expected \"Name: value\"")
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		return nil
+	})
+	user := fs.String("user", "", "User of HTTP basic authentication, \"name\" asks for the password, or \"name:password\"")
+	caFile := fs.String("tls-ca", "", "PEM file of the CAs to verify the server certificate")
+	certFile := fs.String("tls-cert", "", "Client certificate file for mutual TLS")
+	keyFile := fs.String("tls-key", "", "Client key file for mutual TLS")
+	insecure := fs.Bool("insecure", false, "Skip the verification of the server certificate, e.g. self-signed")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: webterm attach [options] URL")
+		fmt.Fprintln(fs.Output(), "URL is the page of a terminal or a share link, e.g. https://host/term/?share=<token>")
+		fmt.Fprintln(fs.Output(), "Press Ctrl-] to detach. The window size of a share link follows the session owner,")
+		fmt.Fprintln(fs.Output(), "resizing the local terminal has no effect then.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		panic(err)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	target, err := dataURL(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid url:", err)
+		os.Exit(1)
+	}
+	if *user != "" {
+		name, password, ok := strings.Cut(*user, ":")
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Password for %s: ", name)
+			b, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "failed to read the password:", err)
+				os.Exit(1)
+			}
+			password = string(b)
+		}
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(name+":"+password)))
+	}
+	tlsConfig, err := clientTLSConfig(*caFile, *certFile, *keyFile, *insecure)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid tls options:", err)
+		os.Exit(1)
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = tlsConfig
+
+	if err := attach(target, header, &dialer); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// attach connects the local terminal to the session until it ends or the user detaches
+func attach(target string, header http.Header, dialer *websocket.Dialer) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("stdin is not a terminal")
+	}
+	cols, rows, err := term.GetSize(fd)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	c, err := webclient.Dial(ctx, target,
+		webclient.WithHeader(header),
+		webclient.WithDialer(dialer),
+		webclient.WithSize(cols, rows))
+	cancel()
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer c.Close()
+
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go watchResize(fd, c, stop)
+
+	// closed when the user presses the detach key, the errors of the input
+	// end the connection or leave the output running until the session ends
+	detached := make(chan struct{})
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if i := bytes.IndexByte(buf[:n], detachKey); i >= 0 {
+				c.Write(buf[:i])
+				close(detached)
+				return
+			}
+			if n > 0 {
+				if _, err := c.Write(buf[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(os.Stdout, c)
+		done <- err
+	}()
+	pressed := false
+	select {
+	case err = <-done:
+	case <-detached:
+		c.Close()
+		pressed = true
+	}
+	term.Restore(fd, state)
+	fmt.Fprintln(os.Stderr)
+	if pressed {
+		fmt.Fprintln(os.Stderr, "detached")
+		return nil
+	}
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) {
+		return fmt.Errorf("session closed: %s", ce.Text)
+	}
+	if err != nil {
+		return fmt.Errorf("connection lost: %w", err)
+	}
+	fmt.Fprintln(os.Stderr, "session ended")
+	return nil
+}
+
+// watchResize sends the size of the local terminal whenever it changes,
+// the server ignores it for the guests of a share link.
+func watchResize(fd int, c *webclient.Client, stop <-chan struct{}) {
+	changed := notifyResize()
+	defer stopResize(changed)
+	for {
+		select {
+		case <-stop:
+			return
+		case <-changed:
+			if cols, rows, err := term.GetSize(fd); err == nil {
+				c.Resize(cols, rows)
+			}
+		}
+	}
+}
+
+// dataURL returns the websocket URL of the terminal page,
+// e.g. "https://host/term/?share=abc" is "wss://host/term/data?share=abc".
+func dataURL(page string) (string, error) {
+	u, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "", errors.New("missing host")
+	}
+	if !strings.HasSuffix(u.Path, "/data") {
+		if !strings.HasSuffix(u.Path, "/") {
+			u.Path += "/"
+		}
+		u.Path += "data"
+	}
+	// the query is passed on like the page does, e.g. "?command=psql" of a menu
+	u.Fragment = ""
+	return u.String(), nil
+}
+
+func clientTLSConfig(caFile, certFile, keyFile string, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", caFile)
+		}
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("-tls-cert and -tls-key are required together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestDataURL(t *testing.T) {
+	tests := []struct {
+		page   string
+		expect string
+	}{
+		{"http://localhost:8080/term/", "ws://localhost:8080/term/data"},
+		{"https://example.com/term", "wss://example.com/term/data"},
+		{"https://example.com/term/?share=abc&x=1#top", "wss://example.com/term/data?share=abc&x=1"},
+		{"https://example.com/tools/?command=psql", "wss://example.com/tools/data?command=psql"},
+		{"wss://example.com/term/data?share=abc", "wss://example.com/term/data?share=abc"},
+		{"http://localhost:8080", "ws://localhost:8080/data"},
+	}
+	for _, tt := range tests {
+		got, err := dataURL(tt.page)
+		if err != nil || got != tt.expect {
+			t.Errorf("dataURL(%q) = %q %v, expected %q", tt.page, got, err, tt.expect)
+		}
+	}
+	for _, page := range []string{"ftp://example.com/", "example.com/term/", "http:///term/"} {
+		if _, err := dataURL(page); err == nil {
+			t.Errorf("dataURL(%q) expected an error", page)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyResize returns a channel receiving SIGWINCH, the local terminal was resized
+func notifyResize() chan os.Signal {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGWINCH)
+	return ch
+}
+
+func stopResize(ch chan os.Signal) {
+	signal.Stop(ch)
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// notifyResize returns a channel that never receives, Windows has no SIGWINCH.
+// The session keeps the size of the console when attached.
+func notifyResize() chan os.Signal {
+	return make(chan os.Signal)
+}
+
+func stopResize(ch chan os.Signal) {}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/OutOfBedlam/webterm"
+	"github.com/OutOfBedlam/webterm/webexec"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of the webterm server,
+// it is read from a YAML, JSON or TOML file.
+type Config struct {
+	// Listen is the TCP address "host:port" or a Unix socket "unix:/path/to/socket"
+	Listen    string              `json:"listen"`
+	TLS       *webterm.TLSOptions `json:"tls,omitempty"`
+	Endpoints []EndpointConfig    `json:"endpoints"`
+}
+
+// EndpointConfig is a terminal mounted under Path
+type EndpointConfig struct {
+	Path string `json:"path"`
+	// Type of the runner: "webexec", "webssh", "webtail", "menu" or "docker",
+	// or "broadcast" for a page sending the same input to the Targets
+	Type string `json:"type"`
+	// Command is the program and its arguments for webexec and docker,
+	// or the remote command for webssh (a login shell if empty).
+	Command []string         `json:"command,omitempty"`
+	Dir     string           `json:"dir,omitempty"` // working directory of webexec
+	Sandbox *webexec.Sandbox `json:"sandbox,omitempty"`
+	// Persist keeps the webexec shells in tmux or screen sessions of the user,
+	// which are listed as JSON at <path>persist.
+	Persist *webexec.Persist `json:"persist,omitempty"`
+	// Workspace gives every user a directory of its own instead of Dir, for webexec and menu
+	Workspace *webexec.Workspace `json:"workspace,omitempty"`
+	// Env are additional variables of webexec, "KEY=value", and InheritEnv the names
+	// of the variables of the server passed to the command, webexec.DefaultInheritEnv if not set.
+	Env        []string                  `json:"env,omitempty"`
+	InheritEnv []string                  `json:"inheritEnv,omitempty"`
+	Hops       []HopConfig               `json:"hops,omitempty"`
+	Files      []TailFileConfig          `json:"files,omitempty"`
+	Targets    []webterm.BroadcastTarget `json:"targets,omitempty"`
+	// Menu are the commands of a menu, Dir, Sandbox, Workspace, Env and InheritEnv apply to all of them
+	Menu   *MenuConfig   `json:"menu,omitempty"`
+	Docker *DockerConfig `json:"docker,omitempty"`
+
+	Theme      string `json:"theme,omitempty"`
+	FontFamily string `json:"fontFamily,omitempty"`
+	FontSize   int    `json:"fontSize,omitempty"`
+	Scrollback int    `json:"scrollback,omitempty"`
+
+	Auth      *AuthConfig              `json:"auth,omitempty"`
+	Limits    *LimitsConfig            `json:"limits,omitempty"`
+	Clipboard *webterm.ClipboardPolicy `json:"clipboard,omitempty"`
+}
+
+// HopConfig is an SSH server on the way to the target, the last hop is the target
+type HopConfig struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port,omitempty"`
+	User       string `json:"user,omitempty"`
+	Password   string `json:"password,omitempty"`
+	KeyFile    string `json:"keyFile,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+type MenuConfig struct {
+	Title   string            `json:"title,omitempty"`
+	Entries []MenuEntryConfig `json:"entries"`
+}
+
+// MenuEntryConfig is a command of a menu, the page selects it with "?command=<name>"
+type MenuEntryConfig struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Command     []string `json:"command"`
+	Dir         string   `json:"dir,omitempty"` // the dir of the endpoint if empty
+	Env         []string `json:"env,omitempty"` // added to the env of the endpoint
+	Roles       []string `json:"roles,omitempty"`
+}
+
+// DockerConfig is the container of a docker endpoint, the page picks it if Container is empty
+type DockerConfig struct {
+	Host       string   `json:"host,omitempty"` // DOCKER_HOST or the Unix socket of the daemon if empty
+	Container  string   `json:"container,omitempty"`
+	Labels     []string `json:"labels,omitempty"` // limits the containers to pick from
+	User       string   `json:"user,omitempty"`
+	WorkingDir string   `json:"workingDir,omitempty"`
+}
+
+type TailFileConfig struct {
+	File       string   `json:"file"`
+	Label      string   `json:"label,omitempty"`
+	Highlights []string `json:"highlights,omitempty"`
+}
+
+type AuthConfig struct {
+	// Type is "basic" for HTTP basic authentication against Users,
+	// "header" to trust the user name in Header set by an authenticating proxy,
+	// or "cert" for the subject of the client certificate, which requires tls.clientCAFile.
+	// Endpoints without auth use "cert" if tls.clientCAFile is set.
+	Type   string       `json:"type"`
+	Realm  string       `json:"realm,omitempty"`
+	Users  []UserConfig `json:"users,omitempty"`
+	Header string       `json:"header,omitempty"`
+}
+
+type UserConfig struct {
+	Name string `json:"name"`
+	// Password is a bcrypt hash, or plain text if it does not start with "$2"
+	Password string   `json:"password"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+type LimitsConfig struct {
+	MaxSessions     int      `json:"maxSessions,omitempty"`
+	MaxPerPrincipal int      `json:"maxPerPrincipal,omitempty"`
+	MaxPerIP        int      `json:"maxPerIP,omitempty"`
+	Queue           bool     `json:"queue,omitempty"`
+	MaxQueue        int      `json:"maxQueue,omitempty"`
+	QueueTimeout    Duration `json:"queueTimeout,omitempty"`
+}
+
+// Duration is a time.Duration written as "30s" or "5m" in the config file
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// LoadConfig reads the config file, the format is chosen by the file extension.
+func LoadConfig(path string) (*Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseConfig(b, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig parses and validates the config in the format of ext: ".yaml", ".yml", ".json" or ".toml".
+// YAML and TOML are converted to JSON first, so all formats use the same keys.
+func ParseConfig(b []byte, ext string) (*Config, error) {
+	var doc any
+	switch strings.ToLower(ext) {
+	case ".json":
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(b), &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format %q", ext)
+	}
+	if doc != nil {
+		var err error
+		if b, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	cfg := &Config{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) Validate() error {
+	if cfg.Listen == "" {
+		return errors.New("listen address is required")
+	}
+	mtls := false
+	if cfg.TLS != nil {
+		if err := cfg.TLS.Validate(); err != nil {
+			return err
+		}
+		mtls = cfg.TLS.ClientCAFile != ""
+	}
+	if len(cfg.Endpoints) == 0 {
+		return errors.New("no endpoints")
+	}
+	paths := map[string]bool{}
+	for i := range cfg.Endpoints {
+		ep := &cfg.Endpoints[i]
+		if ep.Auth == nil && mtls {
+			ep.Auth = &AuthConfig{Type: "cert"}
+		}
+		if err := ep.validate(mtls); err != nil {
+			return fmt.Errorf("endpoint %q: %w", ep.Path, err)
+		}
+		if paths[ep.Path] {
+			return fmt.Errorf("endpoint %q: duplicate path", ep.Path)
+		}
+		paths[ep.Path] = true
+	}
+	return nil
+}
+
+func (ep *EndpointConfig) validate(mtls bool) error {
+	if !strings.HasPrefix(ep.Path, "/") {
+		return errors.New("path must start with /")
+	}
+	if !strings.HasSuffix(ep.Path, "/") {
+		ep.Path += "/"
+	}
+	switch ep.Type {
+	case "webexec":
+		if len(ep.Command) == 0 {
+			return errors.New("webexec requires a command")
+		}
+	case "webssh":
+		if len(ep.Hops) == 0 {
+			return errors.New("webssh requires hops")
+		}
+		for _, hop := range ep.Hops {
+			if hop.Host == "" {
+				return errors.New("hop requires a host")
+			}
+		}
+	case "webtail":
+		if len(ep.Files) == 0 {
+			return errors.New("webtail requires files")
+		}
+	case "broadcast":
+		if len(ep.Targets) == 0 {
+			return errors.New("broadcast requires targets")
+		}
+	case "menu":
+		if ep.Menu == nil || len(ep.Menu.Entries) == 0 {
+			return errors.New("menu requires entries")
+		}
+		names := map[string]bool{}
+		for _, e := range ep.Menu.Entries {
+			if e.Name == "" || len(e.Command) == 0 {
+				return errors.New("menu entry requires a name and a command")
+			}
+			if names[e.Name] {
+				return fmt.Errorf("duplicate menu entry %q", e.Name)
+			}
+			names[e.Name] = true
+		}
+	case "docker":
+		if ep.Docker == nil {
+			ep.Docker = &DockerConfig{}
+		}
+	default:
+		return fmt.Errorf("unknown type %q, expected webexec, webssh, webtail, menu, docker or broadcast", ep.Type)
+	}
+	if ep.Sandbox != nil && ep.Type != "webexec" && ep.Type != "menu" {
+		return errors.New("sandbox requires webexec or menu")
+	}
+	if w := ep.Workspace; w != nil {
+		if ep.Type != "webexec" && ep.Type != "menu" {
+			return errors.New("workspace requires webexec or menu")
+		}
+		if !filepath.IsAbs(w.Root) {
+			return errors.New("workspace requires an absolute root")
+		}
+		if w.Ephemeral && ep.Persist != nil {
+			return errors.New("ephemeral workspace can not be used with persist")
+		}
+	}
+	if p := ep.Persist; p != nil {
+		if ep.Type != "webexec" {
+			return errors.New("persist requires webexec")
+		}
+		if p.Tool != "" && p.Tool != "tmux" && p.Tool != "screen" {
+			return fmt.Errorf("unknown persist tool %q, expected tmux or screen", p.Tool)
+		}
+		// the tmux or screen server would be killed with the namespace when the client exits
+		if ep.Sandbox != nil && ep.Sandbox.Namespaces.PID {
+			return errors.New("persist can not be used with a pid namespace sandbox")
+		}
+	}
+	if _, ok := themes[ep.Theme]; !ok && ep.Theme != "" {
+		return fmt.Errorf("unknown theme %q", ep.Theme)
+	}
+	if c := ep.Clipboard; c != nil {
+		for _, mode := range []webterm.ClipboardMode{c.Write, c.Read} {
+			switch mode {
+			case "", webterm.ClipboardDeny, webterm.ClipboardAllow, webterm.ClipboardAsk:
+			default:
+				return fmt.Errorf("unknown clipboard mode %q, expected allow, deny or ask", mode)
+			}
+		}
+	}
+	if ep.Auth != nil {
+		switch ep.Auth.Type {
+		case "basic":
+			if len(ep.Auth.Users) == 0 {
+				return errors.New("basic auth requires users")
+			}
+		case "header":
+			if ep.Auth.Header == "" {
+				return errors.New("header auth requires a header")
+			}
+		case "cert":
+			if !mtls {
+				return errors.New("cert auth requires tls.clientCAFile")
+			}
+		default:
+			return fmt.Errorf("unknown auth type %q, expected basic, header or cert", ep.Auth.Type)
+		}
+	}
+	return nil
+}
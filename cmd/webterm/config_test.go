@@ -0,0 +1,173 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testConfigs = map[string]string{
+	".yaml": `
+listen: unix:/tmp/webterm.sock
+endpoints:
+  - path: /shell
+    type: webexec
+    command: [bash, -l]
+    theme: dracula
+    auth:
+      type: basic
+      users:
+        - {name: alice, password: secret, roles: [dev]}
+    limits:
+      maxSessions: 2
+      queueTimeout: 5m
+  - path: /logs/
+    type: webtail
+    files:
+      - {file: /var/log/syslog, label: syslog}
+`,
+	".json": `{
+  "listen": "unix:/tmp/webterm.sock",
+  "endpoints": [
+    {"path": "/shell", "type": "webexec", "command": ["bash", "-l"], "theme": "dracula",
+     "auth": {"type": "basic", "users": [{"name": "alice", "password": "secret", "roles": ["dev"]}]},
+     "limits": {"maxSessions": 2, "queueTimeout": "5m"}},
+    {"path": "/logs/", "type": "webtail", "files": [{"file": "/var/log/syslog", "label": "syslog"}]}
+  ]
+}`,
+	".toml": `
+listen = "unix:/tmp/webterm.sock"
+
+[[endpoints]]
+path = "/shell"
+type = "webexec"
+command = ["bash", "-l"]
+theme = "dracula"
+auth = { type = "basic", users = [{ name = "alice", password = "secret", roles = ["dev"] }] }
+limits = { maxSessions = 2, queueTimeout = "5m" }
+
+[[endpoints]]
+path = "/logs/"
+type = "webtail"
+files = [{ file = "/var/log/syslog", label = "syslog" }]
+`,
+}
+
+func TestParseConfig(t *testing.T) {
+	for ext, src := range testConfigs {
+		cfg, err := ParseConfig([]byte(src), ext)
+		if err != nil {
+			t.Errorf("%s: %v", ext, err)
+			continue
+		}
+		if len(cfg.Endpoints) != 2 {
+			t.Fatalf("%s: expected 2 endpoints, got %d", ext, len(cfg.Endpoints))
+		}
+		shell, logs := cfg.Endpoints[0], cfg.Endpoints[1]
+		if shell.Path != "/shell/" || shell.Command[1] != "-l" || shell.Auth.Users[0].Roles[0] != "dev" {
+			t.Errorf("%s: unexpected endpoint %+v", ext, shell)
+		}
+		if time.Duration(shell.Limits.QueueTimeout) != 5*time.Minute {
+			t.Errorf("%s: expected queue timeout 5m, got %v", ext, shell.Limits.QueueTimeout)
+		}
+		if logs.Files[0].Label != "syslog" {
+			t.Errorf("%s: unexpected endpoint %+v", ext, logs)
+		}
+	}
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	tests := []struct {
+		src    string
+		expect string
+	}{
+		{`{"endpoints": [{"path": "/", "type": "webexec", "command": ["sh"]}]}`, "listen address is required"},
+		{`{"listen": ":8080"}`, "no endpoints"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webshell"}]}`, `unknown type "webshell"`},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webexec"}]}`, "requires a command"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "broadcast"}]}`, "requires targets"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "menu"}]}`, "menu requires entries"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "menu", "menu": {"entries": [{"name": "a", "command": ["sh"]}, {"name": "a", "command": ["bash"]}]}}]}`, `duplicate menu entry "a"`},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webexec", "command": ["sh"], "clipboard": {"write": "yes"}}]}`, `unknown clipboard mode "yes"`},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webexec", "command": ["sh"], "theme": "pink"}]}`, `unknown theme "pink"`},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webtail", "files": [{"file": "a.log"}], "sandbox": {"readOnlyRoot": true}}]}`, "sandbox requires webexec"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webtail", "files": [{"file": "a.log"}], "persist": {}}]}`, "persist requires webexec"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webexec", "command": ["sh"], "persist": {"tool": "zellij"}}]}`, `unknown persist tool "zellij"`},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webexec", "command": ["sh"], "sandbox": {"namespaces": {"pid": true}}, "persist": {}}]}`, "pid namespace"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webexec", "command": ["sh"], "workspace": {"root": "srv"}}]}`, "absolute root"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webexec", "command": ["sh"], "workspace": {"root": "/srv", "ephemeral": true}, "persist": {}}]}`, "can not be used with persist"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "docker", "docker": {"image": "x"}}]}`, `unknown field "image"`},
+		{`{"listen": ":8080", "endpoints": [{"path": "/a", "type": "webexec", "command": ["sh"]}, {"path": "/a/", "type": "webexec", "command": ["sh"]}]}`, "duplicate path"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webexec", "command": ["sh"], "comand": ["sh"]}]}`, `unknown field "comand"`},
+		{`{"listen": ":8080", "tls": {"certFile": "cert.pem"}, "endpoints": [{"path": "/", "type": "webexec", "command": ["sh"]}]}`, "both certFile and keyFile"},
+		{`{"listen": ":8080", "endpoints": [{"path": "/", "type": "webexec", "command": ["sh"], "auth": {"type": "cert"}}]}`, "requires tls.clientCAFile"},
+	}
+	for _, tt := range tests {
+		_, err := ParseConfig([]byte(tt.src), ".json")
+		if err == nil || !strings.Contains(err.Error(), tt.expect) {
+			t.Errorf("Expected error %q, got %v", tt.expect, err)
+		}
+	}
+}
+
+func TestParseConfigMutualTLS(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+listen: :8443
+tls: {selfSigned: true, clientCAFile: /etc/webterm/ca.pem}
+endpoints:
+  - {path: /shell/, type: webexec, command: [bash]}
+  - {path: /logs/, type: webtail, files: [{file: /var/log/syslog}], auth: {type: header, header: X-User}}
+`), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a := cfg.Endpoints[0].Auth; a == nil || a.Type != "cert" {
+		t.Errorf("Expected cert auth by default with mutual TLS, got %+v", a)
+	}
+	if a := cfg.Endpoints[1].Auth; a.Type != "header" {
+		t.Errorf("Expected the configured auth to stay, got %+v", a)
+	}
+}
+
+func TestEndpointAuth(t *testing.T) {
+	cfg, err := ParseConfig([]byte(testConfigs[".yaml"]), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+
+	get := func(path, user, password string) *http.Response {
+		req, _ := http.NewRequest("GET", hs.URL+path, nil)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rsp.Body.Close()
+		return rsp
+	}
+	if rsp := get("/shell/", "", ""); rsp.StatusCode != http.StatusUnauthorized || rsp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("Expected basic auth challenge, got %d", rsp.StatusCode)
+	}
+	if rsp := get("/shell/", "alice", "wrong"); rsp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong password, got %d", rsp.StatusCode)
+	}
+	if rsp := get("/shell/", "alice", "secret"); rsp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200, got %d", rsp.StatusCode)
+	}
+	if rsp := get("/shell/webterm.js", "", ""); rsp.StatusCode != http.StatusOK {
+		t.Errorf("Expected static assets without auth, got %d", rsp.StatusCode)
+	}
+	if rsp := get("/logs/", "", ""); rsp.StatusCode != http.StatusOK {
+		t.Errorf("Expected endpoint without auth, got %d", rsp.StatusCode)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/OutOfBedlam/webterm/webdocker"
+	"github.com/OutOfBedlam/webterm/webexec"
+	"github.com/OutOfBedlam/webterm/webssh"
+	"github.com/OutOfBedlam/webterm/webtail"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+)
+
+var themes = map[string]webterm.TerminalTheme{
+	"default":         webterm.ThemeDefault,
+	"solarized-dark":  webterm.ThemeSolarizedDark,
+	"solarized-light": webterm.ThemeSolarizedLight,
+	"molokai":         webterm.ThemeMolokai,
+	"ubuntu":          webterm.ThemeUbuntu,
+	"dracula":         webterm.ThemeDracula,
+	"nordic":          webterm.ThemeNordic,
+	"light":           webterm.ThemeLight,
+}
+
+// Endpoint is a WebTerm built from an EndpointConfig
+type Endpoint struct {
+	Config  EndpointConfig
+	Path    string
+	Term    *webterm.WebTerm // nil for a broadcast page, it has no sessions
+	Handler http.Handler
+}
+
+// NewEndpoint builds the endpoint of the config, prev is the endpoint it replaces or nil,
+// the new WebTerm takes over its sessions.
+func NewEndpoint(ep EndpointConfig, prev *Endpoint) (*Endpoint, error) {
+	opts := []webterm.Option{webterm.WithCutPrefix(ep.Path)}
+	if ep.Theme != "" {
+		opts = append(opts, webterm.WithTheme(themes[ep.Theme]))
+	}
+	if ep.FontFamily != "" {
+		opts = append(opts, webterm.WithFontFamily(ep.FontFamily))
+	}
+	if ep.FontSize > 0 {
+		opts = append(opts, webterm.WithFontSize(ep.FontSize))
+	}
+	if ep.Scrollback > 0 {
+		opts = append(opts, webterm.WithScrollback(ep.Scrollback))
+	}
+	if ep.Clipboard != nil {
+		opts = append(opts, webterm.WithClipboard(*ep.Clipboard))
+	}
+	var auth webterm.Authenticator
+	if ep.Auth != nil {
+		auth = newAuthenticator(ep.Auth)
+		opts = append(opts, webterm.WithAuthenticator(auth))
+	}
+	if l := ep.Limits; l != nil {
+		opts = append(opts, webterm.WithLimits(webterm.Limits{
+			MaxSessions:     l.MaxSessions,
+			MaxPerPrincipal: l.MaxPerPrincipal,
+			MaxPerIP:        l.MaxPerIP,
+			Queue:           l.Queue,
+			MaxQueue:        l.MaxQueue,
+			QueueTimeout:    time.Duration(l.QueueTimeout),
+		}))
+	}
+	var term *webterm.WebTerm
+	var handler http.Handler
+	if ep.Type == "broadcast" {
+		handler = webterm.NewBroadcast(ep.Targets, opts...)
+	} else {
+		runner, err := newRunner(ep)
+		if err != nil {
+			return nil, err
+		}
+		if prev != nil && prev.Term != nil {
+			opts = append(opts, webterm.WithSessionsOf(prev.Term))
+		}
+		term = webterm.New(runner, opts...)
+		handler = term
+		if ep.Persist != nil {
+			mux := http.NewServeMux()
+			mux.Handle(ep.Path, term)
+			mux.Handle("GET "+ep.Path+"persist", ep.Persist.Handler(auth))
+			handler = mux
+		}
+	}
+	if auth != nil {
+		handler = requireAuth(ep.Path, ep.Auth, auth, handler)
+	}
+	return &Endpoint{Config: ep, Path: ep.Path, Term: term, Handler: handler}, nil
+}
+
+func newRunner(ep EndpointConfig) (webterm.Runner, error) {
+	switch ep.Type {
+	case "webexec":
+		return &webexec.WebExec{
+			Command:    ep.Command[0],
+			Args:       ep.Command[1:],
+			Dir:        ep.Dir,
+			Sandbox:    ep.Sandbox,
+			Persist:    ep.Persist,
+			Workspace:  ep.Workspace,
+			Env:        ep.Env,
+			InheritEnv: ep.InheritEnv,
+		}, nil
+	case "menu":
+		menu := &webexec.Menu{Title: ep.Menu.Title}
+		for _, e := range ep.Menu.Entries {
+			dir := e.Dir
+			if dir == "" {
+				dir = ep.Dir
+			}
+			menu.Entries = append(menu.Entries, webexec.MenuEntry{
+				Name:        e.Name,
+				Label:       e.Label,
+				Description: e.Description,
+				Roles:       e.Roles,
+				WebExec: webexec.WebExec{
+					Command:    e.Command[0],
+					Args:       e.Command[1:],
+					Dir:        dir,
+					Sandbox:    ep.Sandbox,
+					Workspace:  ep.Workspace,
+					Env:        append(slices.Clip(ep.Env), e.Env...),
+					InheritEnv: ep.InheritEnv,
+				},
+			})
+		}
+		return menu, nil
+	case "docker":
+		return &webdocker.WebDocker{
+			Host:       ep.Docker.Host,
+			Container:  ep.Docker.Container,
+			Labels:     ep.Docker.Labels,
+			Command:    ep.Command,
+			User:       ep.Docker.User,
+			WorkingDir: ep.Docker.WorkingDir,
+			Env:        ep.Env,
+		}, nil
+	case "webssh":
+		var hops webssh.Hops
+		for _, h := range ep.Hops {
+			hop := webssh.Hop{Host: h.Host, Port: h.Port, User: h.User}
+			if h.KeyFile != "" {
+				key, err := os.ReadFile(h.KeyFile)
+				if err != nil {
+					return nil, err
+				}
+				var signer ssh.Signer
+				if h.Passphrase != "" {
+					signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(h.Passphrase))
+				} else {
+					signer, err = ssh.ParsePrivateKey(key)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", h.KeyFile, err)
+				}
+				hop.Auth = append(hop.Auth, ssh.PublicKeys(signer))
+			}
+			if h.Password != "" {
+				hop.Auth = append(hop.Auth, webssh.AuthPassword(h.Password))
+			}
+			hops = append(hops, hop)
+		}
+		return &webssh.WebSSH{Hops: hops, TermType: "xterm-256color", Command: strings.Join(ep.Command, " ")}, nil
+	case "webtail":
+		var tails []webtail.TailConfig
+		for _, f := range ep.Files {
+			tails = append(tails, webtail.TailConfig{Filename: f.File, Label: f.Label, Highlights: f.Highlights})
+		}
+		return &webtail.WebTail{Tails: tails}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", ep.Type)
+}
+
+var errUnauthorized = errors.New("unauthorized")
+
+func newAuthenticator(cfg *AuthConfig) webterm.Authenticator {
+	switch cfg.Type {
+	case "cert":
+		return webterm.AuthenticateClientCert
+	case "header":
+		header := cfg.Header
+		return func(r *http.Request) (webterm.Principal, error) {
+			name := r.Header.Get(header)
+			if name == "" {
+				return webterm.Principal{}, errUnauthorized
+			}
+			return webterm.Principal{Name: name}, nil
+		}
+	default:
+		users := map[string]UserConfig{}
+		for _, u := range cfg.Users {
+			users[u.Name] = u
+		}
+		return func(r *http.Request) (webterm.Principal, error) {
+			name, password, ok := r.BasicAuth()
+			if !ok {
+				return webterm.Principal{}, errUnauthorized
+			}
+			u, exists := users[name]
+			if !exists || !checkPassword(u.Password, password) {
+				return webterm.Principal{}, errUnauthorized
+			}
+			return webterm.Principal{Name: u.Name, Roles: u.Roles}, nil
+		}
+	}
+}
+
+func checkPassword(stored, password string) bool {
+	if strings.HasPrefix(stored, "$2") {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
+
+// requireAuth authenticates the terminal page too, not only the sessions,
+// so the browser asks for the basic auth credentials when the page is opened.
+// Guests with a share link and the static assets are let through,
+// the sessions and exports are authenticated by the WebTerm.
+func requireAuth(path string, cfg *AuthConfig, auth webterm.Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path || r.URL.Query().Has("share") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, err := auth(r); err != nil {
+			if cfg.Type == "basic" {
+				realm := cfg.Realm
+				if realm == "" {
+					realm = "webterm"
+				}
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", realm))
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func main() {
+	serveSet := flag.NewFlagSet("serve", flag.ExitOnError)
+	attachSet := flag.NewFlagSet("attach", flag.ExitOnError)
+	flag.Usage = usage
+	flag.Parse()
+	switch flag.Arg(0) {
+	case "serve":
+		serveCommand(serveSet, flag.Args()[1:])
+	case "attach":
+		attachCommand(attachSet, flag.Args()[1:])
+	default:
+		usage()
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage: webterm <command> [options]")
+	fmt.Println("Commands:")
+	fmt.Println("  serve    Start the webterm server")
+	fmt.Println("  attach   Attach the local terminal to a webterm session")
+	fmt.Println("Use 'webterm <command> -h' for more information about a command.")
+}
+
+func serveCommand(fs *flag.FlagSet, args []string) {
+	configPath := fs.String("config", "webterm.yaml", "Config file, .yaml, .json or .toml")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 30*time.Second, "Time to wait for the sessions to end on shutdown")
+	watch := fs.Duration("watch", 0, "Reload the config when the file changes, checking at this interval (0 reloads only on SIGHUP)")
+	if err := fs.Parse(args); err != nil {
+		panic(err)
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo})))
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid config:", err)
+		os.Exit(1)
+	}
+	srv, err := NewServer(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid config:", err)
+		os.Exit(1)
+	}
+	lis, err := Listen(cfg.Listen)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to listen:", err)
+		os.Exit(1)
+	}
+	logEndpoints(srv)
+	slog.Info("webterm start", "listen", cfg.Listen, "tls", cfg.TLS != nil)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(lis)
+	}()
+
+	reload := func() {
+		if err := srv.ReloadFile(*configPath); err != nil {
+			slog.Error("webterm config rejected, keeping the current endpoints", "error", err)
+			return
+		}
+		slog.Info("webterm config reloaded")
+		logEndpoints(srv)
+	}
+	reloadCh := make(chan struct{}, 1)
+	if *watch > 0 {
+		go WatchFile(context.Background(), *configPath, *watch, func() {
+			select {
+			case reloadCh <- struct{}{}:
+			default: // a reload is pending
+			}
+		})
+	}
+
+	// wait signal ^C, reload on SIGHUP
+	signalCh := make(chan os.Signal, 1)
+	signal.Notify(signalCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+wait:
+	for {
+		select {
+		case sig := <-signalCh:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			reload()
+		case <-reloadCh:
+			reload()
+		case err := <-serveErr:
+			slog.Error("webterm server failed", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	slog.Info("Shutting down webterm")
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	srv.Shutdown(ctx)
+}
+
+func logEndpoints(srv *Server) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for _, ep := range srv.endpoints {
+		slog.Info("webterm endpoint", "path", ep.Path, "type", ep.Config.Type)
+	}
+}
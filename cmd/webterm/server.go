@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Server serves the endpoints of a Config, the endpoints can be replaced by Reload
+type Server struct {
+	mu        sync.Mutex
+	cfg       *Config
+	endpoints []*Endpoint
+	retired   []*Endpoint // replaced endpoints that still had sessions
+	mux       atomic.Pointer[http.ServeMux]
+	http      *http.Server
+}
+
+func NewServer(cfg *Config) (*Server, error) {
+	s := &Server{cfg: cfg}
+	if err := s.Reload(cfg); err != nil {
+		return nil, err
+	}
+	s.http = &http.Server{Handler: s}
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.Config()
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		s.http.TLSConfig = tlsConfig
+	}
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.Load().ServeHTTP(w, r)
+}
+
+// Reload replaces the endpoints with the ones of cfg. Endpoints with an unchanged config are kept as they are.
+// The sessions of the replaced endpoints keep running on their old runner, new connections get the new config.
+// A replaced endpoint hands its sessions over to the new one, which counts them for the limits
+// and serves their share links and exports. The sessions of removed endpoints are kept until they end.
+// If an endpoint can not be built the error is returned and the current endpoints stay in place.
+// Changes of listen and tls take effect after a restart.
+func (s *Server) Reload(cfg *Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cfg.Listen != s.cfg.Listen || !reflect.DeepEqual(cfg.TLS, s.cfg.TLS) {
+		slog.Warn("webterm listen and tls changes take effect after restart")
+		cfg.Listen, cfg.TLS = s.cfg.Listen, s.cfg.TLS
+	}
+	current := map[string]*Endpoint{}
+	for _, ep := range s.endpoints {
+		current[ep.Path] = ep
+	}
+	var endpoints, handedOver []*Endpoint
+	mux := http.NewServeMux()
+	for _, epc := range cfg.Endpoints {
+		ep := current[epc.Path]
+		if ep == nil || !reflect.DeepEqual(ep.Config, epc) {
+			next, err := NewEndpoint(epc, ep)
+			if err != nil {
+				return fmt.Errorf("endpoint %q: %w", epc.Path, err)
+			}
+			if ep != nil && ep.Term != nil && next.Term != nil {
+				handedOver = append(handedOver, ep)
+			}
+			ep = next
+		}
+		endpoints = append(endpoints, ep)
+		mux.Handle(ep.Path, ep.Handler)
+	}
+	for _, ep := range s.endpoints {
+		if !slices.Contains(endpoints, ep) && !slices.Contains(handedOver, ep) {
+			s.retired = append(s.retired, ep)
+		}
+	}
+	s.retired = slices.DeleteFunc(s.retired, func(ep *Endpoint) bool {
+		return ep.Term == nil || len(ep.Term.Sessions()) == 0
+	})
+	s.cfg = cfg
+	s.endpoints = endpoints
+	s.mux.Store(mux)
+	return nil
+}
+
+// ReloadFile loads the config file and reloads the endpoints,
+// an invalid config is rejected and the current endpoints stay in place.
+func (s *Server) ReloadFile(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	return s.Reload(cfg)
+}
+
+// WatchFile calls fn when the modification time or the size of the file changes,
+// it polls the file every interval until ctx is done.
+func WatchFile(ctx context.Context, path string, interval time.Duration, fn func()) {
+	stat := func() (time.Time, int64) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return fi.ModTime(), fi.Size()
+	}
+	lastMod, lastSize := stat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		mod, size := stat()
+		if size < 0 || (mod.Equal(lastMod) && size == lastSize) {
+			continue
+		}
+		lastMod, lastSize = mod, size
+		fn()
+	}
+}
+
+// Listen opens the TCP address or the Unix socket of the config.
+// A stale socket file is removed first, any other file at the path is an error.
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if fi, err := os.Lstat(path); err == nil {
+			if fi.Mode()&os.ModeSocket == 0 {
+				return nil, fmt.Errorf("listen %s: the file exists and is not a socket", path)
+			}
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// Serve serves on lis until Shutdown is called
+func (s *Server) Serve(lis net.Listener) error {
+	var err error
+	if s.http.TLSConfig != nil {
+		err = s.http.ServeTLS(lis, "", "")
+	} else {
+		err = s.http.Serve(lis)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown ends the sessions of all endpoints gracefully, then stops the http server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	endpoints := append(slices.Clone(s.endpoints), s.retired...)
+	s.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, ep := range endpoints {
+		if ep.Term == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ep.Term.Shutdown(ctx); err != nil {
+				slog.Error("webterm failed to shutdown endpoint", "path", ep.Path, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+	return s.http.Shutdown(ctx)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func mustParse(t *testing.T, src string) *Config {
+	t.Helper()
+	cfg, err := ParseConfig([]byte(src), ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestReload(t *testing.T) {
+	srv, err := NewServer(mustParse(t, `
+listen: 127.0.0.1:0
+endpoints:
+  - {path: /cat/, type: webexec, command: [cat]}
+  - {path: /logs/, type: webtail, files: [{file: /var/log/syslog}]}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := httptest.NewServer(srv)
+	defer hs.Close()
+	catEndpoint, logsEndpoint := srv.endpoints[0], srv.endpoints[1]
+
+	// a live session on the endpoint that will be replaced
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http")+"/cat/data", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatalf("Expected session event: %v", err)
+	}
+
+	err = srv.Reload(mustParse(t, `
+listen: 127.0.0.1:0
+endpoints:
+  - {path: /cat/, type: webexec, command: [cat, "-"], limits: {maxSessions: 1}}
+  - {path: /logs/, type: webtail, files: [{file: /var/log/syslog}]}
+  - {path: /new/, type: webexec, command: [cat]}
+`))
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if srv.endpoints[0] == catEndpoint || srv.endpoints[1] != logsEndpoint {
+		t.Errorf("Expected only the changed endpoint to be replaced")
+	}
+	if len(srv.retired) != 0 {
+		t.Errorf("Expected the replaced endpoint to hand its session over, got %d retired", len(srv.retired))
+	}
+	// the new endpoint counts the session, shares and exports it
+	sessions := srv.endpoints[0].Term.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("Expected the session on the new endpoint, got %v", sessions)
+	}
+	share, err := srv.endpoints[0].Term.Share(sessions[0].ID, time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp, err := http.Get(hs.URL + "/cat/export?format=text&share=" + share.Token); err != nil || rsp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the export of the old session, got %v %v", rsp.StatusCode, err)
+	}
+	full, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(hs.URL, "http")+"/cat/data", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer full.Close()
+	for {
+		full.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := full.ReadMessage(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+				t.Errorf("Expected the old session to count for the limit, got %v", err)
+			}
+			break
+		}
+	}
+	if rsp, err := http.Get(hs.URL + "/new/"); err != nil || rsp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the new endpoint, got %v %v", rsp.StatusCode, err)
+	}
+
+	// the session keeps running on the old runner
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01hello\n"))
+	var out strings.Builder
+	for !strings.Contains(out.String(), "hello") {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected the old session to keep running, got %q %v", out.String(), err)
+		}
+		out.Write(msg)
+	}
+
+	// an endpoint that can not be built is rejected and the current endpoints stay
+	err = srv.Reload(mustParse(t, `
+listen: 127.0.0.1:0
+endpoints:
+  - {path: /ssh/, type: webssh, hops: [{host: example.com, keyFile: /nonexistent/key}]}
+`))
+	if err == nil || !strings.Contains(err.Error(), `endpoint "/ssh/"`) {
+		t.Errorf("Expected the reload to be rejected, got %v", err)
+	}
+	if rsp, err := http.Get(hs.URL + "/new/"); err != nil || rsp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the endpoints to stay after a rejected reload, got %v %v", rsp.StatusCode, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	srv.Shutdown(ctx)
+	if n := len(catEndpoint.Term.Sessions()); n != 0 {
+		t.Errorf("Expected shutdown to close the sessions of replaced endpoints, got %d", n)
+	}
+}
+
+func TestWatchFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webterm.yaml")
+	os.WriteFile(path, []byte("a"), 0o644)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 1)
+	go WatchFile(ctx, path, 10*time.Millisecond, func() { changed <- struct{}{} })
+	time.Sleep(30 * time.Millisecond)
+	os.WriteFile(path, []byte("ab"), 0o644)
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected a change notification")
+	}
+}
+
+func TestListen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webterm.sock")
+	lis, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the socket is left behind, e.g. by a crash, it is replaced
+	lis.(*net.UnixListener).SetUnlinkOnClose(false)
+	lis.Close()
+	if lis, err = Listen("unix:" + path); err != nil {
+		t.Fatalf("Expected the stale socket to be replaced, got %v", err)
+	}
+	lis.Close()
+
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(file, []byte("listen: :8080\n"), 0o600)
+	if _, err := Listen("unix:" + file); err == nil {
+		t.Errorf("Expected an error for a file which is not a socket")
+	}
+	if b, err := os.ReadFile(file); err != nil || string(b) != "listen: :8080\n" {
+		t.Errorf("Expected the file to be kept, got %q %v", b, err)
+	}
+}
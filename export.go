@@ -0,0 +1,357 @@
+package webterm
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+type ExportFormat string
+
+const (
+	ExportHTML ExportFormat = "html"
+	ExportSVG  ExportFormat = "svg"
+	ExportText ExportFormat = "text"
+)
+
+// ContentType returns the MIME type of the export format.
+func (ef ExportFormat) ContentType() string {
+	switch ef {
+	case ExportHTML:
+		return "text/html; charset=utf-8"
+	case ExportSVG:
+		return "image/svg+xml"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// Ext returns the file extension of the export format.
+func (ef ExportFormat) Ext() string {
+	switch ef {
+	case ExportHTML:
+		return ".html"
+	case ExportSVG:
+		return ".svg"
+	default:
+		return ".txt"
+	}
+}
+
+func ParseExportFormat(s string) (ExportFormat, error) {
+	switch strings.ToLower(s) {
+	case "html", "":
+		return ExportHTML, nil
+	case "svg":
+		return ExportSVG, nil
+	case "text", "txt":
+		return ExportText, nil
+	default:
+		return "", fmt.Errorf("unsupported export format: %s", s)
+	}
+}
+
+// Export writes the scrollback and the screen in the given format.
+// HTML and SVG exports are rendered with the theme and font of opts.
+func (s *Screen) Export(w io.Writer, format ExportFormat, opts TerminalOptions) error {
+	switch format {
+	case ExportHTML:
+		return s.WriteHTML(w, opts)
+	case ExportSVG:
+		return s.WriteSVG(w, opts)
+	case ExportText:
+		return s.WriteText(w)
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+}
+
+// WriteText writes the scrollback and the screen as plain text without any escape sequences.
+func (s *Screen) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, ln := range s.Lines() {
+		for _, c := range ln {
+			bw.WriteRune(c.Rune)
+		}
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// WriteANSI writes the scrollback and the screen as terminal output with SGR
+// color codes and leaves the cursor at its position, it is used to replay
+// the screen to clients attaching to a running session.
+func (s *Screen) WriteANSI(w io.Writer) error {
+	lines, curX, curY := s.snapshot()
+	bw := bufio.NewWriter(w)
+	for i, ln := range lines {
+		if i > 0 {
+			bw.WriteString("\r\n")
+		}
+		for _, run := range styleRuns(ln) {
+			if run.style == defaultStyle {
+				bw.WriteString(run.text)
+				continue
+			}
+			bw.WriteString(sgrSequence(run.style))
+			bw.WriteString(run.text)
+			bw.WriteString(ColorReset)
+		}
+	}
+	if up := len(lines) - 1 - curY; up > 0 {
+		fmt.Fprintf(bw, "\x1b[%dA", up)
+	}
+	fmt.Fprintf(bw, "\r\x1b[%dG", curX+1)
+	return bw.Flush()
+}
+
+// sgrSequence returns the SGR escape sequence that selects st
+func sgrSequence(st Style) string {
+	ps := []string{"0"}
+	attrs := []struct {
+		attr Attr
+		code string
+	}{
+		{AttrBold, "1"}, {AttrFaint, "2"}, {AttrItalic, "3"}, {AttrUnderline, "4"},
+		{AttrBlink, "5"}, {AttrInverse, "7"}, {AttrHidden, "8"}, {AttrStrike, "9"},
+	}
+	for _, a := range attrs {
+		if st.Attr&a.attr != 0 {
+			ps = append(ps, a.code)
+		}
+	}
+	color := func(c Color, base int) {
+		if r, g, b, ok := c.RGB(); ok {
+			ps = append(ps, fmt.Sprintf("%d;2;%d;%d;%d", base+8, r, g, b))
+		} else if c >= 0 && c < 8 {
+			ps = append(ps, fmt.Sprint(base+int(c)))
+		} else if c >= 8 && c < 16 {
+			ps = append(ps, fmt.Sprint(base+60+int(c)-8))
+		} else if c >= 16 && c < 256 {
+			ps = append(ps, fmt.Sprintf("%d;5;%d", base+8, c))
+		}
+	}
+	color(st.Fg, 30)
+	color(st.Bg, 40)
+	return "\x1b[" + strings.Join(ps, ";") + "m"
+}
+
+// WriteHTML writes the scrollback and the screen as a standalone HTML document.
+func (s *Screen) WriteHTML(w io.Writer, opts TerminalOptions) error {
+	pal := newPalette(opts.Theme)
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"UTF-8\">\n<title>%s</title>\n</head>\n",
+		html.EscapeString("webterm "+time.Now().Format(time.RFC3339)))
+	fmt.Fprintf(bw, "<body style=\"margin:0;background-color:%s\">\n", pal.bg)
+	fmt.Fprintf(bw, "<pre style=\"margin:0;padding:8px;color:%s;background-color:%s;font-family:%s;font-size:%dpx;line-height:%g\">",
+		pal.fg, pal.bg, html.EscapeString(opts.FontFamily), fontSize(opts), lineHeight(opts))
+	for _, ln := range s.Lines() {
+		for _, run := range styleRuns(ln) {
+			text := html.EscapeString(run.text)
+			if run.style == defaultStyle {
+				bw.WriteString(text)
+				continue
+			}
+			fmt.Fprintf(bw, "<span style=\"%s\">%s</span>", pal.css(run.style), text)
+		}
+		bw.WriteByte('\n')
+	}
+	bw.WriteString("</pre>\n</body>\n</html>\n")
+	return bw.Flush()
+}
+
+// WriteSVG writes the scrollback and the screen as a standalone SVG image.
+func (s *Screen) WriteSVG(w io.Writer, opts TerminalOptions) error {
+	pal := newPalette(opts.Theme)
+	lines := s.Lines()
+	cols, _ := s.Size()
+	for _, ln := range lines {
+		cols = max(cols, len(ln))
+	}
+	const pad = 8
+	fs := float64(fontSize(opts))
+	charW := fs * 0.6
+	lineH := fs * lineHeight(opts)
+	width := float64(cols)*charW + 2*pad
+	height := float64(len(lines))*lineH + 2*pad
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%.0f\" height=\"%.0f\" viewBox=\"0 0 %.0f %.0f\">\n",
+		width, height, width, height)
+	fmt.Fprintf(bw, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", pal.bg)
+	fmt.Fprintf(bw, "<g font-family=\"%s\" font-size=\"%.0f\" fill=\"%s\" xml:space=\"preserve\">\n",
+		html.EscapeString(opts.FontFamily), fs, pal.fg)
+	for y, ln := range lines {
+		top := pad + float64(y)*lineH
+		baseline := top + (lineH+fs*0.7)/2
+		x := 0
+		for _, run := range styleRuns(ln) {
+			n := len([]rune(run.text))
+			fg, bg := pal.colors(run.style)
+			if bg != pal.bg {
+				fmt.Fprintf(bw, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\"/>\n",
+					pad+float64(x)*charW, top, float64(n)*charW, lineH, bg)
+			}
+			if strings.TrimSpace(run.text) != "" && run.style.Attr&AttrHidden == 0 {
+				fmt.Fprintf(bw, "<text x=\"%.1f\" y=\"%.1f\"", pad+float64(x)*charW, baseline)
+				if fg != pal.fg {
+					fmt.Fprintf(bw, " fill=\"%s\"", fg)
+				}
+				if run.style.Attr&AttrBold != 0 {
+					bw.WriteString(" font-weight=\"bold\"")
+				}
+				if run.style.Attr&AttrItalic != 0 {
+					bw.WriteString(" font-style=\"italic\"")
+				}
+				if run.style.Attr&AttrFaint != 0 {
+					bw.WriteString(" opacity=\"0.5\"")
+				}
+				if deco := textDecoration(run.style); deco != "" {
+					fmt.Fprintf(bw, " text-decoration=\"%s\"", deco)
+				}
+				fmt.Fprintf(bw, " textLength=\"%.1f\">%s</text>\n", float64(n)*charW, html.EscapeString(run.text))
+			}
+			x += n
+		}
+	}
+	bw.WriteString("</g>\n</svg>\n")
+	return bw.Flush()
+}
+
+func fontSize(opts TerminalOptions) int {
+	if opts.FontSize > 0 {
+		return opts.FontSize
+	}
+	return 12
+}
+
+func lineHeight(opts TerminalOptions) float64 {
+	if opts.LineHeight > 0 {
+		return opts.LineHeight
+	}
+	return 1.2
+}
+
+type styleRun struct {
+	style Style
+	text  string
+}
+
+// styleRuns splits a line into runs of cells with the same style.
+func styleRuns(ln []Cell) []styleRun {
+	var ret []styleRun
+	var sb strings.Builder
+	for i, c := range ln {
+		if i > 0 && c.Style != ln[i-1].Style {
+			ret = append(ret, styleRun{style: ln[i-1].Style, text: sb.String()})
+			sb.Reset()
+		}
+		sb.WriteRune(c.Rune)
+	}
+	if len(ln) > 0 {
+		ret = append(ret, styleRun{style: ln[len(ln)-1].Style, text: sb.String()})
+	}
+	return ret
+}
+
+func textDecoration(st Style) string {
+	var deco []string
+	if st.Attr&AttrUnderline != 0 {
+		deco = append(deco, "underline")
+	}
+	if st.Attr&AttrStrike != 0 {
+		deco = append(deco, "line-through")
+	}
+	return strings.Join(deco, " ")
+}
+
+// palette resolves cell colors to CSS colors of a TerminalTheme
+type palette struct {
+	fg    string
+	bg    string
+	table [256]string
+}
+
+func newPalette(theme TerminalTheme) *palette {
+	or := func(s, def string) string {
+		if s == "" {
+			return def
+		}
+		return s
+	}
+	def := ThemeDefault
+	p := &palette{
+		fg: or(theme.Foreground, def.Foreground),
+		bg: or(theme.Background, def.Background),
+	}
+	ansi := []string{
+		or(theme.Black, def.Black), or(theme.Red, def.Red), or(theme.Green, def.Green), or(theme.Yellow, def.Yellow),
+		or(theme.Blue, def.Blue), or(theme.Magenta, def.Magenta), or(theme.Cyan, def.Cyan), or(theme.White, def.White),
+		or(theme.BrightBlack, def.BrightBlack), or(theme.BrightRed, def.BrightRed), or(theme.BrightGreen, def.BrightGreen), or(theme.BrightYellow, def.BrightYellow),
+		or(theme.BrightBlue, def.BrightBlue), or(theme.BrightMagenta, def.BrightMagenta), or(theme.BrightCyan, def.BrightCyan), or(theme.BrightWhite, def.BrightWhite),
+	}
+	copy(p.table[:], ansi)
+	levels := []int{0, 95, 135, 175, 215, 255}
+	for i := 0; i < 216; i++ {
+		p.table[16+i] = fmt.Sprintf("#%02x%02x%02x", levels[i/36], levels[(i/6)%6], levels[i%6])
+	}
+	for i := 0; i < 24; i++ {
+		v := 8 + i*10
+		p.table[232+i] = fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+	return p
+}
+
+func (p *palette) color(c Color, def string) string {
+	if r, g, b, ok := c.RGB(); ok {
+		return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+	}
+	if c >= 0 && c < 256 {
+		return p.table[c]
+	}
+	return def
+}
+
+// colors returns the foreground and background colors of st
+func (p *palette) colors(st Style) (string, string) {
+	fg := st.Fg
+	// bold text is rendered with the bright variants of the base colors
+	if st.Attr&AttrBold != 0 && fg >= 0 && fg < 8 {
+		fg += 8
+	}
+	fgColor, bgColor := p.color(fg, p.fg), p.color(st.Bg, p.bg)
+	if st.Attr&AttrInverse != 0 {
+		fgColor, bgColor = bgColor, fgColor
+	}
+	return fgColor, bgColor
+}
+
+func (p *palette) css(st Style) string {
+	var sb strings.Builder
+	fg, bg := p.colors(st)
+	if fg != p.fg {
+		fmt.Fprintf(&sb, "color:%s;", fg)
+	}
+	if bg != p.bg {
+		fmt.Fprintf(&sb, "background-color:%s;", bg)
+	}
+	if st.Attr&AttrBold != 0 {
+		sb.WriteString("font-weight:bold;")
+	}
+	if st.Attr&AttrFaint != 0 {
+		sb.WriteString("opacity:0.5;")
+	}
+	if st.Attr&AttrItalic != 0 {
+		sb.WriteString("font-style:italic;")
+	}
+	if deco := textDecoration(st); deco != "" {
+		fmt.Fprintf(&sb, "text-decoration:%s;", deco)
+	}
+	if st.Attr&AttrHidden != 0 {
+		sb.WriteString("visibility:hidden;")
+	}
+	return sb.String()
+}
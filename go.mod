@@ -3,9 +3,11 @@ module github.com/OutOfBedlam/webterm
 go 1.24.5
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/creack/pty v1.1.24
 	github.com/gorilla/websocket v1.5.3
 	golang.org/x/crypto v0.45.0
+	golang.org/x/sys v0.38.0
+	golang.org/x/term v0.37.0
+	gopkg.in/yaml.v3 v3.0.1
 )
-
-require golang.org/x/sys v0.38.0 // indirect
@@ -0,0 +1,232 @@
+package webterm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Limits caps the number of concurrent sessions, zero values mean unlimited.
+type Limits struct {
+	MaxSessions     int // sessions of the WebTerm
+	MaxPerPrincipal int // sessions of one principal, anonymous sessions are not counted
+	MaxPerIP        int // sessions from one remote IP address
+	// Queue makes new sessions wait for a free slot instead of being rejected,
+	// the waiting users see their position in the queue.
+	Queue        bool
+	MaxQueue     int           // length of the queue, zero means unlimited
+	QueueTimeout time.Duration // zero waits until the user gives up
+}
+
+func WithLimits(limits Limits) Option {
+	return func(wt *WebTerm) {
+		wt.limits = limits
+	}
+}
+
+// LimitError reports which limit rejected a session
+type LimitError struct {
+	Reason string
+}
+
+func (e *LimitError) Error() string {
+	return e.Reason
+}
+
+var ErrQueueTimeout = errors.New("timed out waiting for a free session")
+
+type limiter struct {
+	limits     Limits
+	mu         sync.Mutex
+	total      int
+	principals map[string]int
+	ips        map[string]int
+	queue      []*waiter
+}
+
+type waiter struct {
+	principal string
+	ip        string
+	ready     chan struct{}
+}
+
+func newLimiter(limits Limits) *limiter {
+	return &limiter{
+		limits:     limits,
+		principals: make(map[string]int),
+		ips:        make(map[string]int),
+	}
+}
+
+// setLimits replaces the limits, e.g. of a WebTerm taking over the sessions
+func (l *limiter) setLimits(limits Limits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	l.grant()
+}
+
+// check returns the limit that a new session of principal and ip exceeds, or nil
+func (l *limiter) check(principal, ip string) error {
+	if l.limits.MaxSessions > 0 && l.total >= l.limits.MaxSessions {
+		return &LimitError{Reason: fmt.Sprintf("The server has reached its limit of %d sessions.", l.limits.MaxSessions)}
+	}
+	if principal != "" && l.limits.MaxPerPrincipal > 0 && l.principals[principal] >= l.limits.MaxPerPrincipal {
+		return &LimitError{Reason: fmt.Sprintf("%s has reached the limit of %d sessions per user.", principal, l.limits.MaxPerPrincipal)}
+	}
+	if l.limits.MaxPerIP > 0 && l.ips[ip] >= l.limits.MaxPerIP {
+		return &LimitError{Reason: fmt.Sprintf("%s has reached the limit of %d sessions per address.", ip, l.limits.MaxPerIP)}
+	}
+	return nil
+}
+
+func (l *limiter) take(principal, ip string) {
+	l.total++
+	if principal != "" {
+		l.principals[principal]++
+	}
+	l.ips[ip]++
+}
+
+// acquire takes a slot, or returns a waiter if the session was queued
+func (l *limiter) acquire(principal, ip string) (*waiter, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.check(principal, ip)
+	// without a queue the waiters left by setLimits are not ahead of the new sessions
+	if err == nil && (len(l.queue) == 0 || !l.limits.Queue) {
+		l.take(principal, ip)
+		return nil, nil
+	}
+	if !l.limits.Queue {
+		return nil, err
+	}
+	if l.limits.MaxQueue > 0 && len(l.queue) >= l.limits.MaxQueue {
+		return nil, &LimitError{Reason: "The server is busy and the queue is full."}
+	}
+	w := &waiter{principal: principal, ip: ip, ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	l.grant()
+	return w, nil
+}
+
+// position returns the 1-based position of w in the queue, 0 if it holds a slot
+func (l *limiter) position(w *waiter) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, qw := range l.queue {
+		if qw == w {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// cancel removes w from the queue, it returns false if w already got a slot
+func (l *limiter) cancel(w *waiter) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, qw := range l.queue {
+		if qw == w {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (l *limiter) release(principal, ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.total--
+	if principal != "" {
+		if l.principals[principal]--; l.principals[principal] <= 0 {
+			delete(l.principals, principal)
+		}
+	}
+	if l.ips[ip]--; l.ips[ip] <= 0 {
+		delete(l.ips, ip)
+	}
+	l.grant()
+}
+
+// grant gives free slots to the waiters in queue order,
+// a waiter blocked by its own per-user or per-address limit does not block the others.
+func (l *limiter) grant() {
+	for i := 0; i < len(l.queue); {
+		if l.limits.MaxSessions > 0 && l.total >= l.limits.MaxSessions {
+			return
+		}
+		w := l.queue[i]
+		if l.check(w.principal, w.ip) != nil {
+			i++
+			continue
+		}
+		l.take(w.principal, w.ip)
+		close(w.ready)
+		l.queue = append(l.queue[:i], l.queue[i+1:]...)
+	}
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// queuePollInterval is how often a waiting user sees the queue position,
+// writing it also detects users who gave up.
+const queuePollInterval = 2 * time.Second
+
+// admit takes a session slot for the client, waiting in the queue if configured.
+// It returns the function that releases the slot.
+func (wt *WebTerm) admit(c *client, principal, ip string) (func(), error) {
+	l := wt.reg.limiter
+	release := func() { l.release(principal, ip) }
+	w, err := l.acquire(principal, ip)
+	if err != nil {
+		return nil, err
+	}
+	if w == nil {
+		return release, nil
+	}
+	var timeout <-chan time.Time
+	if wt.limits.QueueTimeout > 0 {
+		timer := time.NewTimer(wt.limits.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+	for {
+		if pos := l.position(w); pos > 0 {
+			msg := fmt.Sprintf("\r\x1b[2K%sWaiting for a free session, position %d in the queue...%s", ColorYellow, pos, ColorReset)
+			err = c.writeMessage(websocket.BinaryMessage, []byte(msg))
+		}
+		if err == nil {
+			select {
+			case <-w.ready:
+				c.writeMessage(websocket.BinaryMessage, []byte("\r\x1b[2K"))
+				return release, nil
+			case <-ticker.C:
+				continue
+			case <-timeout:
+				err = ErrQueueTimeout
+			case <-wt.reg.shutdownCh:
+				err = ErrShutdown
+			}
+		}
+		// the user left or timed out
+		if !l.cancel(w) {
+			release()
+		}
+		return nil, err
+	}
+}
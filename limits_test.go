@@ -0,0 +1,150 @@
+package webterm
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(Limits{MaxSessions: 4, MaxPerPrincipal: 2, MaxPerIP: 2})
+	acquire := func(principal, ip string) error {
+		_, err := l.acquire(principal, ip)
+		return err
+	}
+	tests := []struct {
+		principal string
+		ip        string
+		ok        bool
+	}{
+		{"alice", "10.0.0.1", true},
+		{"alice", "10.0.0.2", true},
+		{"alice", "10.0.0.3", false}, // per principal
+		{"", "10.0.0.1", true},       // anonymous is not a principal
+		{"bob", "10.0.0.1", false},   // per IP
+		{"bob", "10.0.0.4", true},
+		{"carol", "10.0.0.5", false}, // global
+	}
+	for i, tt := range tests {
+		if err := acquire(tt.principal, tt.ip); (err == nil) != tt.ok {
+			t.Errorf("case %d: %s@%s expected ok=%v, got %v", i, tt.principal, tt.ip, tt.ok, err)
+		}
+	}
+	l.release("", "10.0.0.1")
+	if err := acquire("bob", "10.0.0.1"); err != nil {
+		t.Errorf("Expected a free slot after release, got %v", err)
+	}
+}
+
+func TestLimiterQueue(t *testing.T) {
+	l := newLimiter(Limits{MaxSessions: 2, MaxPerPrincipal: 1, Queue: true})
+	if w, err := l.acquire("alice", "ip1"); w != nil || err != nil {
+		t.Fatalf("Expected a slot, got %v %v", w, err)
+	}
+	// alice waits for the per principal limit, that must not block bob
+	wAlice, _ := l.acquire("alice", "ip1")
+	wBob, _ := l.acquire("bob", "ip2")
+	if wAlice == nil || wBob == nil {
+		t.Fatalf("Expected waiters")
+	}
+	select {
+	case <-wBob.ready:
+	default:
+		t.Errorf("Expected bob to get the free slot")
+	}
+	if pos := l.position(wAlice); pos != 1 {
+		t.Errorf("Expected alice at position 1, got %d", pos)
+	}
+	wCarol, _ := l.acquire("carol", "ip3")
+	if pos := l.position(wCarol); pos != 2 {
+		t.Errorf("Expected carol at position 2, got %d", pos)
+	}
+	// the first session of alice ends, the queued one takes the slot
+	l.release("alice", "ip1")
+	select {
+	case <-wAlice.ready:
+	default:
+		t.Errorf("Expected alice to get a slot")
+	}
+	if pos := l.position(wCarol); pos != 1 {
+		t.Errorf("Expected carol at position 1, got %d", pos)
+	}
+	if !l.cancel(wCarol) {
+		t.Errorf("Expected carol to be removed from the queue")
+	}
+	if l.cancel(wAlice) {
+		t.Errorf("Expected alice to hold a slot")
+	}
+}
+
+func TestLimiterQueueOff(t *testing.T) {
+	l := newLimiter(Limits{MaxSessions: 3, MaxPerPrincipal: 1, Queue: true})
+	l.acquire("alice", "10.0.0.1")
+	w, _ := l.acquire("alice", "10.0.0.2")
+	if w == nil {
+		t.Fatalf("Expected alice to wait for her own slot")
+	}
+
+	// the waiter stays queued when the queue is turned off
+	l.setLimits(Limits{MaxSessions: 3, MaxPerPrincipal: 1})
+	if w, err := l.acquire("bob", "10.0.0.3"); w != nil || err != nil {
+		t.Fatalf("Expected a slot for bob, got %v %v", w, err)
+	}
+	if _, err := l.acquire("alice", "10.0.0.4"); err == nil {
+		t.Errorf("Expected alice to be rejected without a queue")
+	}
+	if l.total != 2 || l.principals["bob"] != 1 {
+		t.Errorf("Expected 2 sessions counted, got %d %v", l.total, l.principals)
+	}
+	l.release("bob", "10.0.0.3")
+	l.release("alice", "10.0.0.1")
+	// the slot of alice went to her waiter
+	if l.position(w) != 0 || l.total != 1 {
+		t.Errorf("Expected the waiter to get the slot, got %d sessions", l.total)
+	}
+}
+
+func TestLimitsReject(t *testing.T) {
+	wt := New(echoRunner{}, WithCutPrefix("/"), WithLimits(Limits{MaxSessions: 1}))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	first := dialData(t, srv, "")
+	defer first.Close()
+	readEvent(t, first)
+
+	second := dialData(t, srv, "")
+	defer second.Close()
+	readOutput(t, second, "limit of 1 sessions")
+	second.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := second.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("Expected try again later close frame, got %v", err)
+	}
+}
+
+func TestLimitsQueue(t *testing.T) {
+	wt := New(echoRunner{}, WithCutPrefix("/"), WithLimits(Limits{MaxSessions: 1, Queue: true}))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	first := dialData(t, srv, "")
+	readEvent(t, first)
+
+	second := dialData(t, srv, "")
+	defer second.Close()
+	readOutput(t, second, "position 1 in the queue")
+
+	first.Close()
+	for {
+		second.SetReadDeadline(time.Now().Add(2 * time.Second))
+		mt, _, err := second.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected session after the queue: %v", err)
+		}
+		if mt == websocket.TextMessage {
+			break
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package webterm
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// Macro is a named input the user can send to the session from the toolbar of the page,
+// e.g. the commands of a runbook. It is either a Text or a sequence of Steps.
+type Macro struct {
+	Name  string // identifies the macro in the requests of the page
+	Label string // shown on the button, Name if empty
+	Text  string // input to send, use "\r" to press enter
+	Steps []MacroStep
+	// Roles limits the macro to sessions of principals with one of the roles, everyone if empty
+	Roles []string
+}
+
+// MacroStep sends Text after waiting for Wait
+type MacroStep struct {
+	Wait time.Duration
+	Text string
+}
+
+// WithMacros declares the macros of the sessions. The page shows them in its toolbar
+// and runs them by name with a control message {"macro": name}, which WebTerm handles
+// instead of the Session. The server sends only the input of declared macros the principal may use.
+func WithMacros(macros ...Macro) Option {
+	return func(wt *WebTerm) {
+		wt.macros = append(wt.macros, macros...)
+	}
+}
+
+func (m Macro) allowed(p Principal) bool {
+	return len(m.Roles) == 0 || slices.ContainsFunc(m.Roles, p.HasRole)
+}
+
+func (m Macro) steps() []MacroStep {
+	if m.Text != "" {
+		return append([]MacroStep{{Text: m.Text}}, m.Steps...)
+	}
+	return m.Steps
+}
+
+// macroButton is a macro as the page sees it, without its input
+type macroButton struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+func macroButtons(macros []Macro) []macroButton {
+	var ret []macroButton
+	for _, m := range macros {
+		label := m.Label
+		if label == "" {
+			label = m.Name
+		}
+		ret = append(ret, macroButton{Name: m.Name, Label: label})
+	}
+	return ret
+}
+
+// macroRequest is a control message that runs a macro, handled by WebTerm itself
+// instead of the Session. "macro" is a reserved key of the control messages.
+type macroRequest struct {
+	Macro string `json:"macro"`
+}
+
+// macro runs the macro requested by a control message,
+// it reports whether data was a macro request.
+// A request is dropped while another macro of the session is running.
+func (ls *liveSession) macro(data []byte) bool {
+	var req macroRequest
+	if json.Unmarshal(data, &req) != nil || req.Macro == "" {
+		return false
+	}
+	idx := slices.IndexFunc(ls.macros, func(m Macro) bool { return m.Name == req.Macro })
+	if idx < 0 {
+		slog.Warn("webterm macro not allowed", "macro", req.Macro, "session", ls.info.ID, "principal", ls.info.Principal.Name)
+		return true
+	}
+	if !ls.macroMu.TryLock() {
+		slog.Warn("webterm macro dropped, another macro is running", "macro", req.Macro, "session", ls.info.ID)
+		return true
+	}
+	go func() {
+		defer ls.macroMu.Unlock()
+		ls.runMacro(ls.macros[idx])
+	}()
+	return true
+}
+
+// runMacro sends the steps of the macro to the session, it stops when the session ends.
+// The caller holds macroMu.
+func (ls *liveSession) runMacro(m Macro) {
+	for _, step := range m.steps() {
+		if step.Wait > 0 {
+			timer := time.NewTimer(step.Wait)
+			select {
+			case <-timer.C:
+			case <-ls.done:
+				timer.Stop()
+				return
+			}
+		}
+		if step.Text == "" {
+			continue
+		}
+		data := []byte(step.Text)
+		ls.observers.each(func(o Observer) { o.SessionInput(ls.currentInfo(), data) })
+		if _, err := ls.session.Write(data); err != nil {
+			slog.Error("webterm failed to write macro", "macro", m.Name, "error", err)
+			return
+		}
+	}
+}
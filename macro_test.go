@@ -0,0 +1,68 @@
+package webterm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMacros(t *testing.T) {
+	wt := New(echoRunner{}, WithCutPrefix("/"),
+		WithAuthenticator(func(r *http.Request) (Principal, error) {
+			return Principal{Name: r.Header.Get("X-User"), Roles: []string{"dev"}}, nil
+		}),
+		WithMacros(
+			Macro{Name: "status", Label: "Status", Text: "status\r"},
+			Macro{Name: "deploy", Steps: []MacroStep{{Text: "build;"}, {Wait: 50 * time.Millisecond, Text: "ship"}}, Roles: []string{"dev"}},
+			Macro{Name: "drop", Text: "drop database\r", Roles: []string{"admin"}},
+		))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/data", http.Header{"X-User": {"alice"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	evt := readEvent(t, conn)
+	if len(evt.Macros) != 2 || evt.Macros[0].Label != "Status" || evt.Macros[1].Label != "deploy" {
+		t.Fatalf("Expected the macros of the principal, got %+v", evt.Macros)
+	}
+
+	// a macro of another role and unknown names are not run
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x02{\"macro\":\"drop\"}"))
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x02{\"macro\":\"rm -rf /\"}"))
+	start := time.Now()
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x02{\"macro\":\"deploy\"}"))
+	// dropped, the first one is still running
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x02{\"macro\":\"deploy\"}"))
+	var out strings.Builder
+	for !strings.Contains(out.String(), "ship") {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected the macro output, got %q %v", out.String(), err)
+		}
+		out.Write(msg)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("Expected the macro to wait between the steps")
+	}
+	time.Sleep(100 * time.Millisecond)
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01end"))
+	for !strings.Contains(out.String(), "end") {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected the input, got %q %v", out.String(), err)
+		}
+		out.Write(msg)
+	}
+	if out.String() != "build;shipend" {
+		t.Errorf("Expected only the input of one deploy macro, got %q", out.String())
+	}
+}
@@ -0,0 +1,135 @@
+package webterm
+
+import (
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// SessionMiddleware decorates a Session, e.g. to record, audit, rate limit or redact it.
+// The returned Session embeds or wraps the given one and overrides the methods of interest.
+type SessionMiddleware func(Session) Session
+
+// WithSessionMiddleware applies the middlewares to every session the WebTerm creates.
+// The first middleware is the outermost, it sees the input first and the output last.
+// It can be used multiple times, the middlewares are appended.
+func WithSessionMiddleware(mw ...SessionMiddleware) Option {
+	return func(wt *WebTerm) {
+		wt.middleware = append(wt.middleware, mw...)
+	}
+}
+
+func chainSession(s Session, mw []SessionMiddleware) Session {
+	for i := len(mw) - 1; i >= 0; i-- {
+		s = mw[i](s)
+	}
+	return s
+}
+
+// TeeOutput copies the output of the session to w, e.g. a recording file.
+// If writing to w fails the error is logged and the copying stops,
+// the session itself is not interrupted.
+func TeeOutput(w io.Writer) SessionMiddleware {
+	return func(s Session) Session {
+		return &teeSession{Session: s, w: w}
+	}
+}
+
+type teeSession struct {
+	Session
+	w      io.Writer
+	failed bool
+}
+
+func (ts *teeSession) Read(p []byte) (int, error) {
+	n, err := ts.Session.Read(p)
+	if n > 0 && !ts.failed {
+		if _, werr := ts.w.Write(p[:n]); werr != nil {
+			slog.Error("webterm failed to tee session output", "error", werr)
+			ts.failed = true
+		}
+	}
+	return n, err
+}
+
+// RateLimitOutput throttles the output of the session to bytesPerSecond,
+// allowing bursts of up to burst bytes. A runaway command then can not flood the clients.
+func RateLimitOutput(bytesPerSecond, burst int) SessionMiddleware {
+	if burst < 1 {
+		burst = 1
+	}
+	return func(s Session) Session {
+		return &rateLimitSession{
+			Session: s,
+			rate:    float64(bytesPerSecond),
+			burst:   float64(burst),
+			tokens:  float64(burst),
+			last:    time.Now(),
+		}
+	}
+}
+
+type rateLimitSession struct {
+	Session
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (rs *rateLimitSession) Read(p []byte) (int, error) {
+	if rs.rate <= 0 {
+		return rs.Session.Read(p)
+	}
+	if limit := rs.wait(); len(p) > limit {
+		p = p[:limit]
+	}
+	n, err := rs.Session.Read(p)
+	rs.mu.Lock()
+	rs.tokens -= float64(n)
+	rs.mu.Unlock()
+	return n, err
+}
+
+// wait blocks until at least one byte may be read and returns how many bytes may be read
+func (rs *rateLimitSession) wait() int {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	now := time.Now()
+	rs.tokens = min(rs.burst, rs.tokens+now.Sub(rs.last).Seconds()*rs.rate)
+	rs.last = now
+	if rs.tokens < 1 {
+		d := time.Duration((1 - rs.tokens) / rs.rate * float64(time.Second))
+		rs.mu.Unlock()
+		time.Sleep(d)
+		rs.mu.Lock()
+		rs.tokens = 1
+		rs.last = time.Now()
+	}
+	return int(rs.tokens)
+}
+
+// FilterInput passes the input of the clients through fn before it reaches the session.
+// fn returns the data to write, which may be modified or empty to drop the input.
+func FilterInput(fn func(data []byte) []byte) SessionMiddleware {
+	return func(s Session) Session {
+		return &filterSession{Session: s, fn: fn}
+	}
+}
+
+type filterSession struct {
+	Session
+	fn func([]byte) []byte
+}
+
+func (fs *filterSession) Write(p []byte) (int, error) {
+	data := fs.fn(p)
+	if len(data) > 0 {
+		if _, err := fs.Session.Write(data); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,92 @@
+package webterm
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestChainSession(t *testing.T) {
+	var order []string
+	named := func(name string) SessionMiddleware {
+		return FilterInput(func(data []byte) []byte {
+			order = append(order, name)
+			return data
+		})
+	}
+	s, _ := echoRunner{}.Session()
+	s = chainSession(s, []SessionMiddleware{named("outer"), named("inner")})
+	go s.Write([]byte("x"))
+	s.Read(make([]byte, 1))
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("Expected outer,inner got %v", order)
+	}
+}
+
+func TestTeeOutput(t *testing.T) {
+	var rec bytes.Buffer
+	s, _ := echoRunner{}.Session()
+	s = TeeOutput(&rec)(s)
+	go func() {
+		s.Write([]byte("hello"))
+		s.Close()
+	}()
+	out, _ := io.ReadAll(s)
+	if string(out) != "hello" || rec.String() != "hello" {
+		t.Errorf("Expected hello in output and recording, got %q %q", out, rec.String())
+	}
+}
+
+func TestRateLimitOutput(t *testing.T) {
+	s, _ := echoRunner{}.Session()
+	s = RateLimitOutput(100, 10)(s)
+	go func() {
+		s.Write(bytes.Repeat([]byte("x"), 30))
+		s.Close()
+	}()
+	start := time.Now()
+	buf := make([]byte, 64)
+	total := 0
+	for {
+		n, err := s.Read(buf)
+		if n > 10 {
+			t.Fatalf("Read %d bytes, more than the burst", n)
+		}
+		total += n
+		if err != nil {
+			break
+		}
+	}
+	// 10 bytes of burst, 20 bytes at 100 bytes/s
+	if elapsed := time.Since(start); total != 30 || elapsed < 150*time.Millisecond {
+		t.Errorf("Expected 30 bytes in about 200ms, got %d in %v", total, elapsed)
+	}
+}
+
+func TestFilterInput(t *testing.T) {
+	redact := FilterInput(func(data []byte) []byte {
+		if bytes.Contains(data, []byte("secret")) {
+			return nil
+		}
+		return bytes.ToUpper(data)
+	})
+	wt := New(echoRunner{}, WithCutPrefix("/"), WithSessionMiddleware(redact))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	conn := dialData(t, srv, "")
+	defer conn.Close()
+	readEvent(t, conn)
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01my secret"))
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01hello"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, msg, err := conn.ReadMessage()
+	if err != nil || string(msg) != "HELLO" {
+		t.Errorf("Expected HELLO, got %q %v", msg, err)
+	}
+}
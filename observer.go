@@ -0,0 +1,55 @@
+package webterm
+
+// Observer receives the lifecycle events of the sessions of a WebTerm.
+// The callbacks are called synchronously from the goroutines that serve
+// the session, they must not block; hand the work over to another goroutine.
+// No lock of the session is held, so they may call WebTerm, e.g. Sessions.
+// The data slices are only valid during the call.
+type Observer interface {
+	// SessionCreated is called when the Runner created a session, before it is opened.
+	SessionCreated(info SessionInfo)
+	// SessionOpened is called when the session has been opened successfully.
+	SessionOpened(info SessionInfo)
+	// SessionInput is called with the input from the clients to the session.
+	SessionInput(info SessionInfo, data []byte)
+	// SessionOutput is called with the output of the session to the clients.
+	SessionOutput(info SessionInfo, data []byte)
+	// SessionResized is called when the window size of the session changes.
+	SessionResized(info SessionInfo, cols, rows int)
+	// SessionControl is called with the control messages from the clients.
+	SessionControl(info SessionInfo, data []byte)
+	// SessionClosed is called when the session has ended.
+	SessionClosed(info SessionInfo)
+	// SessionError is called when creating, opening or operating the session fails.
+	SessionError(info SessionInfo, err error)
+}
+
+// NopObserver implements Observer with no-ops, embed it into
+// an observer to implement only the callbacks of interest.
+type NopObserver struct{}
+
+var _ Observer = NopObserver{}
+
+func (NopObserver) SessionCreated(SessionInfo)           {}
+func (NopObserver) SessionOpened(SessionInfo)            {}
+func (NopObserver) SessionInput(SessionInfo, []byte)     {}
+func (NopObserver) SessionOutput(SessionInfo, []byte)    {}
+func (NopObserver) SessionResized(SessionInfo, int, int) {}
+func (NopObserver) SessionControl(SessionInfo, []byte)   {}
+func (NopObserver) SessionClosed(SessionInfo)            {}
+func (NopObserver) SessionError(SessionInfo, error)      {}
+
+// WithObserver registers an Observer, it can be used multiple times.
+func WithObserver(o Observer) Option {
+	return func(wt *WebTerm) {
+		wt.observers = append(wt.observers, o)
+	}
+}
+
+type observers []Observer
+
+func (obs observers) each(fn func(o Observer)) {
+	for _, o := range obs {
+		fn(o)
+	}
+}
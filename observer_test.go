@@ -0,0 +1,114 @@
+package webterm
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type recordObserver struct {
+	mu     sync.Mutex
+	events []string
+	ids    map[string]bool
+	closed chan struct{}
+}
+
+func (ro *recordObserver) record(info SessionInfo, event string) {
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	ro.events = append(ro.events, event)
+	ro.ids[info.ID] = true
+}
+
+func (ro *recordObserver) SessionCreated(info SessionInfo) { ro.record(info, "created") }
+func (ro *recordObserver) SessionOpened(info SessionInfo)  { ro.record(info, "opened") }
+func (ro *recordObserver) SessionInput(info SessionInfo, data []byte) {
+	ro.record(info, "input "+string(data))
+}
+func (ro *recordObserver) SessionOutput(info SessionInfo, data []byte) {
+	ro.record(info, "output "+string(data))
+}
+func (ro *recordObserver) SessionResized(info SessionInfo, cols, rows int) {
+	ro.record(info, fmt.Sprintf("resized %dx%d", cols, rows))
+}
+func (ro *recordObserver) SessionControl(info SessionInfo, data []byte) {
+	ro.record(info, "control "+string(data))
+}
+func (ro *recordObserver) SessionClosed(info SessionInfo) {
+	ro.record(info, "closed")
+	close(ro.closed)
+}
+func (ro *recordObserver) SessionError(info SessionInfo, err error) {
+	ro.record(info, "error "+err.Error())
+}
+
+func TestObserver(t *testing.T) {
+	ro := &recordObserver{ids: map[string]bool{}, closed: make(chan struct{})}
+	// the NopObserver must not interfere with the others
+	wt := New(echoRunner{}, WithCutPrefix("/"), WithObserver(NopObserver{}), WithObserver(ro))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	conn := dialData(t, srv, "")
+	evt := readEvent(t, conn)
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x00{\"cols\":100,\"rows\":30}"))
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x02ping"))
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01hello"))
+	readOutput(t, conn, "hello")
+	conn.Close()
+
+	select {
+	case <-ro.closed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the session to be closed")
+	}
+	ro.mu.Lock()
+	defer ro.mu.Unlock()
+	expect := []string{"created", "opened", "resized 100x30", "control ping", "input hello", "output hello", "closed"}
+	if fmt.Sprint(ro.events) != fmt.Sprint(expect) {
+		t.Errorf("Expected events %q, got %q", expect, ro.events)
+	}
+	if len(ro.ids) != 1 || !ro.ids[evt.ID] {
+		t.Errorf("Expected all events of session %s, got %v", evt.ID, ro.ids)
+	}
+}
+
+// sessionsObserver calls WebTerm.Sessions from the callbacks
+type sessionsObserver struct {
+	NopObserver
+	wt     *WebTerm
+	titles chan string
+}
+
+func (so *sessionsObserver) SessionOutput(info SessionInfo, data []byte) {
+	for _, s := range so.wt.Sessions() {
+		if s.ID == info.ID {
+			so.titles <- s.Title
+		}
+	}
+}
+
+func TestObserverSessions(t *testing.T) {
+	so := &sessionsObserver{titles: make(chan string, 16)}
+	wt := New(echoRunner{}, WithCutPrefix("/"), WithObserver(so))
+	so.wt = wt
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	conn := dialData(t, srv, "")
+	defer conn.Close()
+	readEvent(t, conn)
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01\x1b]2;build\x07"))
+	select {
+	case title := <-so.titles:
+		if title != "build" {
+			t.Errorf("Expected the title of the output, got %q", title)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the observer to list the sessions")
+	}
+}
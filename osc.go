@@ -0,0 +1,59 @@
+package webterm
+
+import (
+	"net/url"
+	"strings"
+)
+
+// titleEvent is sent to the clients when the title or the working directory of the session changes
+type titleEvent struct {
+	Title string `json:"title"`
+	Cwd   string `json:"cwd"`
+}
+
+// maxTitleLength caps the title and the working directory recorded from the output
+const maxTitleLength = 512
+
+// trackOSC records the title (OSC 0 and 2) and the working directory (OSC 7)
+// of the session from the output, it is called with ls.mu held.
+func (ls *liveSession) trackOSC(tok AnsiToken) {
+	if tok.Kind != AnsiOSC {
+		return
+	}
+	code, arg, _ := strings.Cut(tok.Data, ";")
+	title, cwd := ls.info.Title, ls.info.Cwd
+	switch code {
+	case "0", "2":
+		title = truncateTitle(arg)
+	case "7":
+		// file://host/path, the path is percent-encoded
+		u, err := url.Parse(arg)
+		if err != nil || u.Scheme != "file" {
+			return
+		}
+		cwd = truncateTitle(u.Path)
+	default:
+		return
+	}
+	if title == ls.info.Title && cwd == ls.info.Cwd {
+		return
+	}
+	ls.info.Title, ls.info.Cwd = title, cwd
+	ls.pending = append(ls.pending, eventMessage("title", titleEvent{Title: title, Cwd: cwd}, false))
+}
+
+func truncateTitle(s string) string {
+	if len(s) > maxTitleLength {
+		s = strings.ToValidUTF8(s[:maxTitleLength], "")
+	}
+	return s
+}
+
+// titleMessage returns the current title for a client that attached late,
+// false if there is none. It is called with ls.mu held.
+func (ls *liveSession) titleMessage() (message, bool) {
+	if ls.info.Title == "" && ls.info.Cwd == "" {
+		return message{}, false
+	}
+	return eventMessage("title", titleEvent{Title: ls.info.Title, Cwd: ls.info.Cwd}, false), true
+}
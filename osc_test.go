@@ -0,0 +1,74 @@
+package webterm
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func readTitle(t *testing.T, conn *websocket.Conn) titleEvent {
+	t.Helper()
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		mt, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected title event: %v", err)
+		}
+		if mt != websocket.TextMessage {
+			continue
+		}
+		evt := struct {
+			Type string     `json:"type"`
+			Data titleEvent `json:"data"`
+		}{}
+		if err := json.Unmarshal(msg, &evt); err == nil && evt.Type == "title" {
+			return evt.Data
+		}
+	}
+}
+
+func TestTrackOSC(t *testing.T) {
+	wt := New(echoRunner{}, WithCutPrefix("/"))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	conn := dialData(t, srv, "")
+	defer conn.Close()
+	info := readEvent(t, conn)
+
+	// split across writes, the parser keeps the state
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01\x1b]0;make bu"))
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01ild\x07"))
+	if evt := readTitle(t, conn); evt.Title != "make build" || evt.Cwd != "" {
+		t.Errorf("Unexpected title event %+v", evt)
+	}
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01\x1b]7;file://host/home/my%20dir\x1b\\"))
+	if evt := readTitle(t, conn); evt.Title != "make build" || evt.Cwd != "/home/my dir" {
+		t.Errorf("Unexpected title event %+v", evt)
+	}
+	sessions := wt.Sessions()
+	if len(sessions) != 1 || sessions[0].Title != "make build" || sessions[0].Cwd != "/home/my dir" {
+		t.Errorf("Expected title and cwd in the registry, got %+v", sessions)
+	}
+
+	// a guest sees the current title on attach
+	share, err := wt.Share(info.ID, time.Minute, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest := dialData(t, srv, "?share="+share.Token)
+	defer guest.Close()
+	if evt := readTitle(t, guest); evt.Title != "make build" {
+		t.Errorf("Expected the title for the guest, got %+v", evt)
+	}
+
+	// long titles are truncated
+	conn.WriteMessage(websocket.BinaryMessage, []byte("\x01\x1b]2;"+strings.Repeat("x", 2*maxTitleLength)+"\x07"))
+	if evt := readTitle(t, conn); len(evt.Title) != maxTitleLength {
+		t.Errorf("Expected title of %d bytes, got %d", maxTitleLength, len(evt.Title))
+	}
+}
@@ -0,0 +1,183 @@
+package webterm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+var _ Session = (*Picker)(nil)
+
+// Picker is a Session that lets the user pick one of its items in the terminal,
+// e.g. the commands of a menu. It draws the list until an item is selected,
+// then it is the Session returned by Start.
+type Picker struct {
+	title string
+	items []string
+	start func(i, cols, rows int) (Session, error)
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	out      bytes.Buffer // the list output not read yet
+	cursor   int
+	cols     int
+	rows     int
+	selected Session
+	closed   bool
+}
+
+// NewPicker returns a picker of the items with the window size, the title is the heading if not empty.
+// start opens the Session of the item i, with the current window size.
+func NewPicker(title string, items []string, cols, rows int, start func(i, cols, rows int) (Session, error)) *Picker {
+	p := &Picker{title: title, items: items, cols: cols, rows: rows, start: start}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// Open draws the list
+func (p *Picker) Open() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.draw()
+	return nil
+}
+
+// Select starts the item i without drawing the list, e.g. for an item of the query of the page
+func (p *Picker) Select(i int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.selectItem(i)
+}
+
+// selectItem starts the item i, p.mu is held
+func (p *Picker) selectItem(i int) error {
+	s, err := p.start(i, p.cols, p.rows)
+	if err != nil {
+		return err
+	}
+	p.selected = s
+	p.cond.Broadcast()
+	return nil
+}
+
+// draw renders the list into out, p.mu is held
+func (p *Picker) draw() {
+	p.out.WriteString("\x1b[H\x1b[2J")
+	if p.title != "" {
+		fmt.Fprintf(&p.out, "\x1b[1m%s\x1b[0m\r\n\r\n", p.title)
+	}
+	for i, item := range p.items {
+		line := fmt.Sprintf(" %d) %s", i+1, item)
+		if i == p.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		p.out.WriteString(line + "\r\n")
+	}
+	p.out.WriteString("\r\nUse the arrow keys or a number, Enter to start, q to quit\r\n")
+	p.cond.Broadcast()
+}
+
+// Read returns the list, then the output of the selected Session.
+// It returns io.EOF when the user quit the list.
+func (p *Picker) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	for p.out.Len() == 0 && p.selected == nil && !p.closed {
+		p.cond.Wait()
+	}
+	if p.out.Len() > 0 {
+		defer p.mu.Unlock()
+		return p.out.Read(b)
+	}
+	selected := p.selected
+	p.mu.Unlock()
+	if selected == nil {
+		return 0, io.EOF
+	}
+	return selected.Read(b)
+}
+
+// Write sends the input to the selected Session, or moves the cursor of the list
+func (p *Picker) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	if selected := p.selected; selected != nil {
+		p.mu.Unlock()
+		return selected.Write(b)
+	}
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	n := len(p.items)
+	for s := string(b); s != ""; {
+		switch {
+		case strings.HasPrefix(s, "\x1b[A"), strings.HasPrefix(s, "\x1bOA"):
+			p.cursor = (p.cursor + n - 1) % n
+			s = s[3:]
+		case strings.HasPrefix(s, "\x1b[B"), strings.HasPrefix(s, "\x1bOB"):
+			p.cursor = (p.cursor + 1) % n
+			s = s[3:]
+		case s[0] >= '1' && s[0] <= '9' && int(s[0]-'1') < n:
+			p.cursor = int(s[0] - '1')
+			s = s[1:]
+		case s[0] == '\r' || s[0] == '\n':
+			if err := p.selectItem(p.cursor); err != nil {
+				fmt.Fprintf(&p.out, "\x1b[31m%s\x1b[0m\r\n", err)
+				p.cond.Broadcast()
+				return len(b), nil
+			}
+			p.out.WriteString("\x1b[H\x1b[2J") // clears the list
+			// the rest of the input, e.g. typed ahead, goes to the selected Session
+			if rest := s[1:]; rest != "" {
+				p.selected.Write([]byte(rest))
+			}
+			return len(b), nil
+		case s[0] == 'q' || s[0] == 0x03 || s[0] == 0x04: // q, Ctrl-C, Ctrl-D
+			p.closed = true
+			p.cond.Broadcast()
+			return len(b), nil
+		default:
+			s = s[1:]
+			continue
+		}
+		p.draw()
+	}
+	return len(b), nil
+}
+
+// SetWinSize resizes the selected Session, the size is kept for Start otherwise
+func (p *Picker) SetWinSize(cols, rows int) error {
+	p.mu.Lock()
+	p.cols, p.rows = cols, rows
+	selected := p.selected
+	p.mu.Unlock()
+	if selected != nil {
+		return selected.SetWinSize(cols, rows)
+	}
+	return nil
+}
+
+// Control is passed to the selected Session, it is ignored before
+func (p *Picker) Control(data []byte) error {
+	p.mu.Lock()
+	selected := p.selected
+	p.mu.Unlock()
+	if selected == nil {
+		return nil
+	}
+	return selected.Control(data)
+}
+
+// Close ends the list and closes the selected Session
+func (p *Picker) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	selected := p.selected
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	if selected != nil {
+		return selected.Close()
+	}
+	return nil
+}
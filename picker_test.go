@@ -0,0 +1,92 @@
+package webterm
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// pickedSession records the input and window size of a picked item
+type pickedSession struct {
+	item   int
+	input  strings.Builder
+	size   [2]int
+	closed bool
+}
+
+func (ps *pickedSession) Open() error                     { return nil }
+func (ps *pickedSession) Close() error                    { ps.closed = true; return nil }
+func (ps *pickedSession) Read(p []byte) (int, error)      { return copy(p, "picked"), nil }
+func (ps *pickedSession) Write(p []byte) (int, error)     { return ps.input.Write(p) }
+func (ps *pickedSession) SetWinSize(cols, rows int) error { ps.size = [2]int{cols, rows}; return nil }
+func (ps *pickedSession) Control(data []byte) error       { return nil }
+
+func readPicker(t *testing.T, p *Picker) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	n, err := p.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf[:n])
+}
+
+func TestPicker(t *testing.T) {
+	var started *pickedSession
+	p := NewPicker("Tools", []string{"shell", "top", "broken"}, 80, 24, func(i, cols, rows int) (Session, error) {
+		if i == 2 {
+			return nil, errors.New("broken item")
+		}
+		started = &pickedSession{item: i, size: [2]int{cols, rows}}
+		return started, nil
+	})
+	p.Open()
+	out := readPicker(t, p)
+	if !strings.Contains(out, "\x1b[1mTools\x1b[0m") || !strings.Contains(out, "\x1b[7m 1) shell\x1b[0m") || !strings.Contains(out, " 3) broken") {
+		t.Fatalf("Unexpected list %q", out)
+	}
+
+	// the cursor wraps around
+	p.Write([]byte("\x1b[A"))
+	if out := readPicker(t, p); !strings.Contains(out, "\x1b[7m 3) broken") {
+		t.Errorf("Expected the cursor on the last item, got %q", out)
+	}
+	p.Write([]byte("\r"))
+	if out := readPicker(t, p); !strings.Contains(out, "\x1b[31mbroken item\x1b[0m") {
+		t.Errorf("Expected the error of the item, got %q", out)
+	}
+
+	p.SetWinSize(100, 30)
+	p.Write([]byte("2\rls\r"))
+	if started == nil || started.item != 1 || started.size != [2]int{100, 30} {
+		t.Fatalf("Expected the second item with the window size, got %+v", started)
+	}
+	if started.input.String() != "ls\r" {
+		t.Errorf("Expected the typed ahead input, got %q", started.input.String())
+	}
+	readPicker(t, p) // the list is cleared
+	if out := readPicker(t, p); out != "picked" {
+		t.Errorf("Expected the output of the item, got %q", out)
+	}
+	p.Close()
+	if !started.closed {
+		t.Errorf("Expected the item to be closed")
+	}
+}
+
+func TestPickerQuit(t *testing.T) {
+	p := NewPicker("", []string{"shell"}, 80, 24, func(i, cols, rows int) (Session, error) {
+		t.Errorf("Expected no item to start")
+		return nil, nil
+	})
+	p.Open()
+	readPicker(t, p)
+	p.Write([]byte("q"))
+	if _, err := p.Read(make([]byte, 16)); err != io.EOF {
+		t.Errorf("Expected EOF after quitting, got %v", err)
+	}
+	if _, err := p.Write([]byte("1")); err != io.ErrClosedPipe {
+		t.Errorf("Expected the picker to be closed, got %v", err)
+	}
+}
@@ -0,0 +1,601 @@
+package webterm
+
+import (
+	"sync"
+	"unicode/utf8"
+)
+
+// Color of a Cell, either DefaultColor, an xterm 256 palette index (0-255),
+// or a 24-bit RGB color created with RGBColor.
+type Color int32
+
+const DefaultColor Color = -1
+
+const colorRGBFlag Color = 1 << 24
+
+func RGBColor(r, g, b uint8) Color {
+	return colorRGBFlag | Color(r)<<16 | Color(g)<<8 | Color(b)
+}
+
+// RGB returns the red, green and blue components and true if c is a 24-bit color.
+func (c Color) RGB() (r, g, b uint8, ok bool) {
+	if c < colorRGBFlag {
+		return 0, 0, 0, false
+	}
+	return uint8(c >> 16), uint8(c >> 8), uint8(c), true
+}
+
+type Attr uint8
+
+const (
+	AttrBold Attr = 1 << iota
+	AttrFaint
+	AttrItalic
+	AttrUnderline
+	AttrBlink
+	AttrInverse
+	AttrHidden
+	AttrStrike
+)
+
+type Style struct {
+	Fg   Color
+	Bg   Color
+	Attr Attr
+}
+
+var defaultStyle = Style{Fg: DefaultColor, Bg: DefaultColor}
+
+type Cell struct {
+	Rune  rune
+	Style Style
+}
+
+type screenLine []Cell
+
+// Screen is a minimal virtual terminal. It keeps the visible screen and
+// the scrollback of a session, so that the output can be exported
+// after the fact. It implements io.Writer.
+type Screen struct {
+	mu         sync.Mutex
+	parser     AnsiParser
+	cols       int
+	rows       int
+	history    lineRing // lines scrolled off the top of the main screen
+	main       []screenLine
+	alt        []screenLine
+	lines      []screenLine // either main or alt
+	curX       int
+	curY       int
+	savedX     int
+	savedY     int
+	savedStyle Style
+	style      Style
+	top        int // scroll region, inclusive
+	bottom     int // scroll region, inclusive
+	wrapNext   bool
+	autoWrap   bool
+}
+
+// NewScreen returns a Screen of the given size that keeps up to scrollback
+// lines that scrolled off the top.
+func NewScreen(cols, rows, scrollback int) *Screen {
+	if cols <= 0 {
+		cols = 80
+	}
+	if rows <= 0 {
+		rows = 24
+	}
+	s := &Screen{
+		cols:     cols,
+		rows:     rows,
+		history:  lineRing{max: scrollback},
+		style:    defaultStyle,
+		autoWrap: true,
+	}
+	s.main = s.blankLines(rows)
+	s.lines = s.main
+	s.top, s.bottom = 0, rows-1
+	return s
+}
+
+func (s *Screen) blankLines(n int) []screenLine {
+	ret := make([]screenLine, n)
+	for i := range ret {
+		ret[i] = s.blankLine()
+	}
+	return ret
+}
+
+func (s *Screen) blankLine() screenLine {
+	ln := make(screenLine, s.cols)
+	for i := range ln {
+		ln[i] = Cell{Rune: ' ', Style: Style{Fg: DefaultColor, Bg: s.style.Bg}}
+	}
+	return ln
+}
+
+// Size returns the current columns and rows of the screen.
+func (s *Screen) Size() (cols, rows int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cols, s.rows
+}
+
+// Resize changes the size of the screen, the content is kept top-left aligned.
+func (s *Screen) Resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resize := func(lines []screenLine, keepHistory bool) []screenLine {
+		if lines == nil {
+			return nil
+		}
+		// keep the cursor on the screen by pushing lines into the history
+		for len(lines) > rows && s.curY > 0 {
+			if keepHistory {
+				s.pushHistory(lines[0])
+			}
+			lines = lines[1:]
+			s.curY--
+		}
+		if len(lines) > rows {
+			lines = lines[:rows]
+		}
+		for i, ln := range lines {
+			lines[i] = resizeLine(ln, cols)
+		}
+		for len(lines) < rows {
+			ln := make(screenLine, cols)
+			for i := range ln {
+				ln[i] = Cell{Rune: ' ', Style: defaultStyle}
+			}
+			lines = append(lines, ln)
+		}
+		return lines
+	}
+	curY := s.curY
+	isAlt := s.alt != nil
+	s.main = resize(s.main, !isAlt)
+	if isAlt {
+		s.curY = curY
+		s.alt = resize(s.alt, false)
+		s.lines = s.alt
+	} else {
+		s.lines = s.main
+	}
+	s.cols, s.rows = cols, rows
+	s.top, s.bottom = 0, rows-1
+	s.curX = min(s.curX, cols-1)
+	s.curY = min(s.curY, rows-1)
+	s.wrapNext = false
+}
+
+func resizeLine(ln screenLine, cols int) screenLine {
+	if len(ln) >= cols {
+		return ln[:cols]
+	}
+	for len(ln) < cols {
+		ln = append(ln, Cell{Rune: ' ', Style: defaultStyle})
+	}
+	return ln
+}
+
+func (s *Screen) pushHistory(ln screenLine) {
+	s.history.push(trimLine(ln))
+}
+
+// lineRing keeps the last max lines, the oldest line is replaced when it is full
+type lineRing struct {
+	lines []screenLine
+	start int // index of the oldest line
+	max   int
+}
+
+func (r *lineRing) push(ln screenLine) {
+	if r.max <= 0 {
+		return
+	}
+	if len(r.lines) < r.max {
+		r.lines = append(r.lines, ln)
+		return
+	}
+	r.lines[r.start] = ln
+	r.start = (r.start + 1) % len(r.lines)
+}
+
+func (r *lineRing) len() int {
+	return len(r.lines)
+}
+
+// at returns the line i, 0 is the oldest
+func (r *lineRing) at(i int) screenLine {
+	return r.lines[(r.start+i)%len(r.lines)]
+}
+
+func (r *lineRing) reset() {
+	r.lines, r.start = nil, 0
+}
+
+// trimLine removes trailing blank cells to save memory in the history.
+func trimLine(ln screenLine) screenLine {
+	end := len(ln)
+	for end > 0 && ln[end-1].Rune == ' ' && ln[end-1].Style == defaultStyle {
+		end--
+	}
+	ret := make(screenLine, end)
+	copy(ret, ln[:end])
+	return ret
+}
+
+// Write feeds the terminal output p into the screen.
+func (s *Screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parser.Feed(p, s.apply)
+	return len(p), nil
+}
+
+func (s *Screen) apply(tok AnsiToken) {
+	switch tok.Kind {
+	case AnsiText:
+		for _, r := range tok.Data {
+			if r == utf8.RuneError {
+				r = '?'
+			}
+			s.put(r)
+		}
+	case AnsiControl:
+		switch tok.Final {
+		case '\r':
+			s.curX = 0
+			s.wrapNext = false
+		case '\n', '\v', '\f':
+			s.lineFeed()
+		case '\b':
+			if s.curX > 0 {
+				s.curX--
+			}
+			s.wrapNext = false
+		case '\t':
+			s.curX = min((s.curX/8+1)*8, s.cols-1)
+			s.wrapNext = false
+		}
+	case AnsiEscape:
+		switch tok.Final {
+		case '7':
+			s.saveCursor()
+		case '8':
+			s.restoreCursor()
+		case 'D':
+			s.lineFeed()
+		case 'E':
+			s.curX = 0
+			s.lineFeed()
+		case 'M':
+			s.reverseIndex()
+		case 'c':
+			s.reset()
+		}
+	case AnsiCSI:
+		s.csi(tok)
+	}
+}
+
+func (s *Screen) put(r rune) {
+	if s.wrapNext {
+		s.curX = 0
+		s.lineFeed()
+	}
+	s.lines[s.curY][s.curX] = Cell{Rune: r, Style: s.style}
+	if s.curX < s.cols-1 {
+		s.curX++
+	} else if s.autoWrap {
+		s.wrapNext = true
+	}
+}
+
+func (s *Screen) lineFeed() {
+	s.wrapNext = false
+	if s.curY == s.bottom {
+		s.scrollUp(1, s.top == 0 && s.alt == nil)
+	} else if s.curY < s.rows-1 {
+		s.curY++
+	}
+}
+
+func (s *Screen) reverseIndex() {
+	s.wrapNext = false
+	if s.curY == s.top {
+		s.scrollDown(1)
+	} else if s.curY > 0 {
+		s.curY--
+	}
+}
+
+// scrollUp scrolls the scroll region up by n lines,
+// if history is true the lines scrolled off are kept as scrollback.
+func (s *Screen) scrollUp(n int, history bool) {
+	for ; n > 0; n-- {
+		if history {
+			s.pushHistory(s.lines[s.top])
+		}
+		copy(s.lines[s.top:s.bottom], s.lines[s.top+1:s.bottom+1])
+		s.lines[s.bottom] = s.blankLine()
+	}
+}
+
+func (s *Screen) scrollDown(n int) {
+	for ; n > 0; n-- {
+		copy(s.lines[s.top+1:s.bottom+1], s.lines[s.top:s.bottom])
+		s.lines[s.top] = s.blankLine()
+	}
+}
+
+func (s *Screen) saveCursor() {
+	s.savedX, s.savedY, s.savedStyle = s.curX, s.curY, s.style
+}
+
+func (s *Screen) restoreCursor() {
+	s.curX, s.curY, s.style = min(s.savedX, s.cols-1), min(s.savedY, s.rows-1), s.savedStyle
+	s.wrapNext = false
+}
+
+func (s *Screen) reset() {
+	s.style = defaultStyle
+	s.main = s.blankLines(s.rows)
+	s.alt = nil
+	s.lines = s.main
+	s.history.reset()
+	s.curX, s.curY = 0, 0
+	s.top, s.bottom = 0, s.rows-1
+	s.wrapNext = false
+	s.autoWrap = true
+}
+
+func (s *Screen) moveTo(x, y int) {
+	s.curX = max(0, min(x, s.cols-1))
+	s.curY = max(0, min(y, s.rows-1))
+	s.wrapNext = false
+}
+
+func (s *Screen) eraseCells(y, from, to int) {
+	ln := s.lines[y]
+	for x := max(from, 0); x < min(to, s.cols); x++ {
+		ln[x] = Cell{Rune: ' ', Style: Style{Fg: DefaultColor, Bg: s.style.Bg}}
+	}
+}
+
+func (s *Screen) csi(tok AnsiToken) {
+	if tok.Intermediate != "" {
+		return
+	}
+	if tok.Private() == '?' {
+		s.privateMode(tok)
+		return
+	}
+	if tok.Private() != 0 {
+		return
+	}
+	n := tok.Param(0, 1)
+	switch tok.Final {
+	case 'A':
+		s.moveTo(s.curX, max(s.curY-n, s.top))
+	case 'B', 'e':
+		s.moveTo(s.curX, min(s.curY+n, s.bottom))
+	case 'C', 'a':
+		s.moveTo(s.curX+n, s.curY)
+	case 'D':
+		s.moveTo(s.curX-n, s.curY)
+	case 'E':
+		s.moveTo(0, s.curY+n)
+	case 'F':
+		s.moveTo(0, s.curY-n)
+	case 'G', '`':
+		s.moveTo(n-1, s.curY)
+	case 'd':
+		s.moveTo(s.curX, n-1)
+	case 'H', 'f':
+		s.moveTo(tok.Param(1, 1)-1, n-1)
+	case 'J':
+		switch tok.Param(0, 0) {
+		case 0:
+			s.eraseCells(s.curY, s.curX, s.cols)
+			for y := s.curY + 1; y < s.rows; y++ {
+				s.eraseCells(y, 0, s.cols)
+			}
+		case 1:
+			s.eraseCells(s.curY, 0, s.curX+1)
+			for y := 0; y < s.curY; y++ {
+				s.eraseCells(y, 0, s.cols)
+			}
+		case 2:
+			for y := 0; y < s.rows; y++ {
+				s.eraseCells(y, 0, s.cols)
+			}
+		case 3:
+			s.history.reset()
+		}
+	case 'K':
+		switch tok.Param(0, 0) {
+		case 0:
+			s.eraseCells(s.curY, s.curX, s.cols)
+		case 1:
+			s.eraseCells(s.curY, 0, s.curX+1)
+		case 2:
+			s.eraseCells(s.curY, 0, s.cols)
+		}
+	case 'X':
+		s.eraseCells(s.curY, s.curX, s.curX+n)
+	case 'P':
+		ln := s.lines[s.curY]
+		n = min(n, s.cols-s.curX)
+		copy(ln[s.curX:], ln[s.curX+n:])
+		s.eraseCells(s.curY, s.cols-n, s.cols)
+	case '@':
+		ln := s.lines[s.curY]
+		n = min(n, s.cols-s.curX)
+		copy(ln[s.curX+n:], ln[s.curX:])
+		s.eraseCells(s.curY, s.curX, s.curX+n)
+	case 'L', 'M':
+		if s.curY < s.top || s.curY > s.bottom {
+			return
+		}
+		top := s.top
+		s.top = s.curY
+		if tok.Final == 'L' {
+			s.scrollDown(min(n, s.bottom-s.curY+1))
+		} else {
+			s.scrollUp(min(n, s.bottom-s.curY+1), false)
+		}
+		s.top = top
+		s.curX = 0
+	case 'S':
+		s.scrollUp(min(n, s.bottom-s.top+1), s.top == 0 && s.alt == nil)
+	case 'T':
+		s.scrollDown(min(n, s.bottom-s.top+1))
+	case 'r':
+		top, bottom := tok.Param(0, 1)-1, tok.Param(1, s.rows)-1
+		if top < bottom && bottom < s.rows {
+			s.top, s.bottom = top, bottom
+			s.moveTo(0, 0)
+		}
+	case 's':
+		s.saveCursor()
+	case 'u':
+		s.restoreCursor()
+	case 'm':
+		s.sgr(tok.IntParams())
+	}
+}
+
+func (s *Screen) privateMode(tok AnsiToken) {
+	set := tok.Final == 'h'
+	if !set && tok.Final != 'l' {
+		return
+	}
+	for _, mode := range tok.IntParams() {
+		switch mode {
+		case 7:
+			s.autoWrap = set
+		case 47, 1047, 1049:
+			if set == (s.alt != nil) {
+				continue
+			}
+			if set {
+				if mode == 1049 {
+					s.saveCursor()
+				}
+				s.alt = s.blankLines(s.rows)
+				s.lines = s.alt
+			} else {
+				s.alt = nil
+				s.lines = s.main
+				if mode == 1049 {
+					s.restoreCursor()
+				}
+			}
+			s.top, s.bottom = 0, s.rows-1
+		}
+	}
+}
+
+func (s *Screen) sgr(ps []int) {
+	if len(ps) == 0 {
+		ps = []int{0}
+	}
+	for i := 0; i < len(ps); i++ {
+		p := ps[i]
+		switch {
+		case p == 0:
+			s.style = defaultStyle
+		case p == 1:
+			s.style.Attr |= AttrBold
+		case p == 2:
+			s.style.Attr |= AttrFaint
+		case p == 3:
+			s.style.Attr |= AttrItalic
+		case p == 4:
+			s.style.Attr |= AttrUnderline
+		case p == 5 || p == 6:
+			s.style.Attr |= AttrBlink
+		case p == 7:
+			s.style.Attr |= AttrInverse
+		case p == 8:
+			s.style.Attr |= AttrHidden
+		case p == 9:
+			s.style.Attr |= AttrStrike
+		case p == 22:
+			s.style.Attr &^= AttrBold | AttrFaint
+		case p == 23:
+			s.style.Attr &^= AttrItalic
+		case p == 24:
+			s.style.Attr &^= AttrUnderline
+		case p == 25:
+			s.style.Attr &^= AttrBlink
+		case p == 27:
+			s.style.Attr &^= AttrInverse
+		case p == 28:
+			s.style.Attr &^= AttrHidden
+		case p == 29:
+			s.style.Attr &^= AttrStrike
+		case p >= 30 && p <= 37:
+			s.style.Fg = Color(p - 30)
+		case p == 39:
+			s.style.Fg = DefaultColor
+		case p >= 40 && p <= 47:
+			s.style.Bg = Color(p - 40)
+		case p == 49:
+			s.style.Bg = DefaultColor
+		case p >= 90 && p <= 97:
+			s.style.Fg = Color(p - 90 + 8)
+		case p >= 100 && p <= 107:
+			s.style.Bg = Color(p - 100 + 8)
+		case p == 38 || p == 48:
+			var c Color
+			switch {
+			case i+2 < len(ps) && ps[i+1] == 5:
+				c = Color(ps[i+2] & 0xff)
+				i += 2
+			case i+4 < len(ps) && ps[i+1] == 2:
+				c = RGBColor(uint8(ps[i+2]), uint8(ps[i+3]), uint8(ps[i+4]))
+				i += 4
+			default:
+				return
+			}
+			if p == 38 {
+				s.style.Fg = c
+			} else {
+				s.style.Bg = c
+			}
+		}
+	}
+}
+
+// Lines returns a copy of the scrollback followed by the visible screen.
+// Trailing blank lines of the screen are omitted.
+func (s *Screen) Lines() [][]Cell {
+	lines, _, _ := s.snapshot()
+	return lines
+}
+
+// snapshot returns the lines like Lines, and the cursor position
+// where y is the index of the cursor line in lines.
+func (s *Screen) snapshot() (lines [][]Cell, x int, y int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lines = make([][]Cell, 0, s.history.len()+len(s.lines))
+	for i := range s.history.len() {
+		lines = append(lines, append([]Cell(nil), s.history.at(i)...))
+	}
+	last := len(s.lines) - 1
+	for last > s.curY && len(trimLine(s.lines[last])) == 0 {
+		last--
+	}
+	for _, ln := range s.lines[:last+1] {
+		lines = append(lines, trimLine(ln))
+	}
+	return lines, s.curX, s.history.len() + s.curY
+}
@@ -0,0 +1,137 @@
+package webterm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func screenText(s *Screen) string {
+	var buf bytes.Buffer
+	s.WriteText(&buf)
+	return buf.String()
+}
+
+func TestScreenText(t *testing.T) {
+	s := NewScreen(20, 5, 100)
+	fmt.Fprint(s, "hello\r\nworld\r\n")
+	fmt.Fprint(s, "abc\rX")                 // carriage return overwrite
+	fmt.Fprint(s, "\r\n12345\x1b[3D\x1b[K") // erase to end of line
+	expected := "hello\nworld\nXbc\n12\n"
+	if got := screenText(s); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestScreenScrollback(t *testing.T) {
+	s := NewScreen(10, 3, 2)
+	for i := 1; i <= 6; i++ {
+		fmt.Fprintf(s, "line %d\r\n", i)
+	}
+	// 3 lines of history capped at 2, screen holds line 5, 6 and the cursor line
+	expected := "line 3\nline 4\nline 5\nline 6\n\n"
+	if got := screenText(s); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestScreenScrollLarge(t *testing.T) {
+	s := NewScreen(10, 3, 5)
+	fmt.Fprint(s, "a\r\nb\r\nc")
+	start := time.Now()
+	// the counts are capped at the height of the scroll region
+	fmt.Fprint(s, "\x1b[999999999S\x1b[999999999T")
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected the scroll to be capped, it took %v", d)
+	}
+	// the lines went to the history, the screen is blank up to the cursor
+	expected := "a\nb\nc\n\n\n\n"
+	if got := screenText(s); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestScreenWrap(t *testing.T) {
+	s := NewScreen(4, 3, 10)
+	fmt.Fprint(s, "abcdefg")
+	expected := "abcd\nefg\n"
+	if got := screenText(s); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestScreenAltScreen(t *testing.T) {
+	s := NewScreen(10, 3, 10)
+	fmt.Fprint(s, "shell$ ")
+	fmt.Fprint(s, "\x1b[?1049h\x1b[Hvim stuff\r\n\r\n\r\n\r\n")
+	fmt.Fprint(s, "\x1b[?1049lls")
+	expected := "shell$ ls\n"
+	if got := screenText(s); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestScreenCursorMove(t *testing.T) {
+	s := NewScreen(10, 3, 10)
+	fmt.Fprint(s, "\x1b[2;3Hx\x1b[1;1Hy\x1b[3;10Hz")
+	expected := "y\n  x\n         z\n"
+	if got := screenText(s); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestScreenStyle(t *testing.T) {
+	s := NewScreen(10, 2, 10)
+	fmt.Fprint(s, "\x1b[1;31mA\x1b[0;38;5;208;48;2;1;2;3mB\x1b[mC")
+	lines := s.Lines()
+	if len(lines) != 1 || len(lines[0]) != 3 {
+		t.Fatalf("Unexpected lines: %+v", lines)
+	}
+	if st := lines[0][0].Style; st.Fg != 1 || st.Attr&AttrBold == 0 {
+		t.Errorf("Unexpected style of A: %+v", st)
+	}
+	if st := lines[0][1].Style; st.Fg != 208 || st.Bg != RGBColor(1, 2, 3) || st.Attr != 0 {
+		t.Errorf("Unexpected style of B: %+v", st)
+	}
+	if st := lines[0][2].Style; st != defaultStyle {
+		t.Errorf("Unexpected style of C: %+v", st)
+	}
+}
+
+func TestScreenExport(t *testing.T) {
+	s := NewScreen(20, 3, 10)
+	fmt.Fprint(s, "\x1b]0;title\x07ok \x1b[31m<red>\x1b[0m")
+	opts := DefaultTerminalOptions()
+	opts.Theme = ThemeDracula
+
+	var buf bytes.Buffer
+	if err := s.Export(&buf, ExportHTML, opts); err != nil {
+		t.Fatalf("Failed to export html: %v", err)
+	}
+	html := buf.String()
+	if !strings.Contains(html, `<span style="color:`+ThemeDracula.Red+`;">&lt;red&gt;</span>`) {
+		t.Errorf("Unexpected html export: %s", html)
+	}
+	if !strings.Contains(html, "background-color:"+ThemeDracula.Background) {
+		t.Errorf("Expected theme background in html export: %s", html)
+	}
+
+	buf.Reset()
+	if err := s.Export(&buf, ExportSVG, opts); err != nil {
+		t.Fatalf("Failed to export svg: %v", err)
+	}
+	svg := buf.String()
+	if !strings.HasPrefix(svg, "<svg ") || !strings.Contains(svg, `fill="`+ThemeDracula.Red+`"`) {
+		t.Errorf("Unexpected svg export: %s", svg)
+	}
+
+	buf.Reset()
+	if err := s.Export(&buf, ExportText, opts); err != nil {
+		t.Fatalf("Failed to export text: %v", err)
+	}
+	if buf.String() != "ok <red>\n" {
+		t.Errorf("Unexpected text export: %q", buf.String())
+	}
+}
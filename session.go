@@ -0,0 +1,384 @@
+package webterm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// SessionInfo describes a live session served by WebTerm.
+type SessionInfo struct {
+	ID         string    `json:"id,omitempty"`
+	Principal  Principal `json:"principal,omitzero"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	CreatedAt  time.Time `json:"createdAt,omitzero"`
+	Clients    int       `json:"clients,omitempty"` // number of attached websockets
+	Title      string    `json:"title,omitempty"`   // set by the OSC 0 and 2 sequences of the output
+	Cwd        string    `json:"cwd,omitempty"`     // working directory, set by the OSC 7 sequence of the output
+	// Cols and Rows are the window size of the owner, from the data URL "?cols=120&rows=40"
+	// when the session is created and from the resize messages after it, zero if unknown.
+	Cols int `json:"cols,omitempty"`
+	Rows int `json:"rows,omitempty"`
+	// Query is the query of the data URL, the page passes its own query on,
+	// e.g. "?command=psql" for a webexec.Menu.
+	Query url.Values `json:"-"`
+}
+
+// liveSession is a Session registered to WebTerm while its owner is connected.
+// Its output is sent to the owner and all clients attached with a share token.
+type liveSession struct {
+	info      SessionInfo // Title, Cwd, Cols and Rows are guarded by mu
+	session   Session
+	screen    *Screen // nil if export is disabled
+	observers observers
+
+	mu      sync.Mutex
+	clients map[*client]struct{}
+	osc     AnsiParser // tracks the title and the working directory
+	clip    *clipboardFilter
+	pending []message // the events of the output being processed, sent with it
+
+	macros  []Macro    // the macros the principal may run
+	macroMu sync.Mutex // runs one macro at a time
+	done    chan struct{}
+}
+
+// client is a websocket attached to a live session
+type client struct {
+	conn     *websocket.Conn
+	wmu      sync.Mutex // serializes writes to conn
+	guest    bool       // attached with a share token
+	readOnly bool
+	shareID  string
+}
+
+func newClient(conn *websocket.Conn, guest bool, readOnly bool) *client {
+	return &client{conn: conn, guest: guest, readOnly: readOnly}
+}
+
+func (c *client) writeMessage(messageType int, data []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.conn.WriteMessage(messageType, data)
+}
+
+func (c *client) writeEvent(typ string, data any) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return c.conn.WriteJSON(Event{Type: typ, Data: data})
+}
+
+// reject prints err into the terminal and closes the websocket with the close code
+func (c *client) reject(err error, code int) {
+	msg := "\r\n" + ColorRed + err.Error() + ColorReset + "\r\n"
+	c.writeMessage(websocket.BinaryMessage, []byte(msg))
+	c.wmu.Lock()
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+	c.wmu.Unlock()
+}
+
+func (c *client) close() {
+	c.conn.Close()
+}
+
+// writeTimeout prevents a stalled client from blocking the other clients of a session
+const writeTimeout = 10 * time.Second
+
+// message is a websocket message for the clients of a session. The messages are
+// collected while mu is held and written after it is released, a slow client
+// does not block the session, e.g. attaching clients and listing the sessions.
+type message struct {
+	typ       int
+	data      []byte
+	ownerOnly bool // not sent to the guests, e.g. the clipboard requests
+}
+
+func eventMessage(typ string, data any, ownerOnly bool) message {
+	b, err := json.Marshal(Event{Type: typ, Data: data})
+	if err != nil {
+		slog.Error("webterm failed to marshal event", "type", typ, "error", err)
+	}
+	return message{typ: websocket.TextMessage, data: b, ownerOnly: ownerOnly}
+}
+
+// attach adds c to the clients of the session, guests receive the current
+// screen first, so late joiners see what the others see.
+func (ls *liveSession) attach(c *client) {
+	ls.mu.Lock()
+	var msgs []message
+	if c.guest && ls.screen != nil {
+		var buf bytes.Buffer
+		ls.screen.WriteANSI(&buf)
+		msgs = append(msgs, message{typ: websocket.BinaryMessage, data: buf.Bytes()})
+	}
+	if m, ok := ls.titleMessage(); ok && c.guest {
+		msgs = append(msgs, m)
+	}
+	// the output sent to c after it is attached waits for the screen
+	c.wmu.Lock()
+	ls.clients[c] = struct{}{}
+	ls.mu.Unlock()
+	defer c.wmu.Unlock()
+	for _, m := range msgs {
+		c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := c.conn.WriteMessage(m.typ, m.data); err != nil {
+			return // the reader of the client sees the error and detaches it
+		}
+	}
+}
+
+// currentInfo returns the info of the session with the current title
+func (ls *liveSession) currentInfo() SessionInfo {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.info
+}
+
+func (ls *liveSession) detach(c *client) {
+	ls.mu.Lock()
+	delete(ls.clients, c)
+	ls.mu.Unlock()
+}
+
+// clientList returns the clients, ls.mu is held
+func (ls *liveSession) clientList() []*client {
+	return slices.Collect(maps.Keys(ls.clients))
+}
+
+// output records p to the screen and sends it to all clients after mu is released,
+// the observers are called after that.
+func (ls *liveSession) output(p []byte) {
+	ls.mu.Lock()
+	if ls.clip != nil {
+		p = ls.clip.filter(p, ls.sendClipboard)
+	}
+	if len(p) > 0 {
+		if ls.screen != nil {
+			ls.screen.Write(p)
+		}
+		ls.osc.Feed(p, ls.trackOSC)
+		ls.pending = append(ls.pending, message{typ: websocket.BinaryMessage, data: p})
+	}
+	msgs, clients := ls.pending, ls.clientList()
+	ls.pending = nil
+	info := ls.info
+	ls.mu.Unlock()
+	ls.send(clients, msgs)
+	if len(p) > 0 {
+		ls.observers.each(func(o Observer) { o.SessionOutput(info, p) })
+	}
+}
+
+// broadcast sends p to all clients without recording it to the screen,
+// it is used for messages of WebTerm itself, e.g. the shutdown notice.
+func (ls *liveSession) broadcast(p []byte) {
+	ls.mu.Lock()
+	clients := ls.clientList()
+	ls.mu.Unlock()
+	ls.send(clients, []message{{typ: websocket.BinaryMessage, data: p}})
+}
+
+// send writes the messages to the clients, mu is not held.
+// A client which fails, e.g. after the writeTimeout, is disconnected.
+func (ls *liveSession) send(clients []*client, msgs []message) {
+	for _, c := range clients {
+		for _, m := range msgs {
+			if m.ownerOnly && c.guest {
+				continue
+			}
+			if err := c.writeMessage(m.typ, m.data); err != nil {
+				slog.Error("webterm failed to write to websocket", "error", err)
+				ls.detach(c)
+				c.close()
+				break
+			}
+		}
+	}
+}
+
+// disconnectShare disconnects the clients attached with the share id
+func (ls *liveSession) disconnectShare(id string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for c := range ls.clients {
+		if c.shareID == id {
+			c.close()
+			delete(ls.clients, c)
+		}
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func newSessionInfo(r *http.Request, principal Principal) SessionInfo {
+	info := SessionInfo{
+		ID:         newSessionID(),
+		Principal:  principal,
+		RemoteAddr: r.RemoteAddr,
+		CreatedAt:  time.Now(),
+		Query:      r.URL.Query(),
+	}
+	cols, errCols := strconv.Atoi(r.URL.Query().Get("cols"))
+	rows, errRows := strconv.Atoi(r.URL.Query().Get("rows"))
+	if errCols == nil && errRows == nil && validWinSize(cols, rows) {
+		info.Cols, info.Rows = cols, rows
+	}
+	return info
+}
+
+// the largest window size accepted from the clients, the screen of a session has this size
+const (
+	maxWinCols = 1000
+	maxWinRows = 500
+)
+
+func validWinSize(cols, rows int) bool {
+	return cols > 0 && rows > 0 && cols <= maxWinCols && rows <= maxWinRows
+}
+
+// registry holds the live sessions of a WebTerm, their shares and the session counts of the limits
+type registry struct {
+	mu          sync.Mutex
+	sessions    map[string]*liveSession
+	closing     bool           // guarded by mu
+	shutdownCh  chan struct{}  // closed when Shutdown is called
+	handlers    sync.WaitGroup // running websocket handlers
+	shareSecret []byte
+	sharesMu    sync.Mutex
+	shares      map[string]Share
+	limiter     *limiter
+}
+
+func newRegistry(shareSecret []byte) *registry {
+	if len(shareSecret) == 0 {
+		shareSecret = randomSecret()
+	}
+	return &registry{
+		sessions:    make(map[string]*liveSession),
+		shutdownCh:  make(chan struct{}),
+		shareSecret: shareSecret,
+		shares:      make(map[string]Share),
+		limiter:     newLimiter(Limits{}),
+	}
+}
+
+func (reg *registry) list() []*liveSession {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	ret := make([]*liveSession, 0, len(reg.sessions))
+	for _, ls := range reg.sessions {
+		ret = append(ret, ls)
+	}
+	return ret
+}
+
+// WithSessionsOf takes over the live sessions of prev, e.g. when a server replaces
+// a WebTerm after a config reload. The sessions keep running on the runner of prev,
+// both WebTerms list, share and export them and count them for the Limits,
+// which are the ones of the new WebTerm. The share links stay valid,
+// the share secret of prev is kept. Shutdown of either ends the sessions of both.
+func WithSessionsOf(prev *WebTerm) Option {
+	return func(wt *WebTerm) {
+		wt.reg = prev.reg
+	}
+}
+
+// register adds the session to the registry. It fails with ErrShutdown once Shutdown
+// has been called, the handler may have passed acquire before and Shutdown misses the session.
+func (wt *WebTerm) register(session Session, info SessionInfo) (*liveSession, error) {
+	ls := &liveSession{
+		info:      info,
+		session:   session,
+		observers: wt.observers,
+		clients:   make(map[*client]struct{}),
+		done:      make(chan struct{}),
+	}
+	if wt.exportEnabled {
+		cols, rows := 80, 24
+		if info.Cols > 0 {
+			cols, rows = info.Cols, info.Rows
+		}
+		ls.screen = NewScreen(cols, rows, wt.terminalOptions.Scrollback)
+	}
+	if wt.clipboard != nil {
+		ls.clip = &clipboardFilter{policy: *wt.clipboard}
+	}
+	for _, m := range wt.macros {
+		if m.allowed(info.Principal) {
+			ls.macros = append(ls.macros, m)
+		}
+	}
+	wt.reg.mu.Lock()
+	defer wt.reg.mu.Unlock()
+	if wt.reg.closing {
+		return nil, ErrShutdown
+	}
+	wt.reg.sessions[ls.info.ID] = ls
+	return ls, nil
+}
+
+func (wt *WebTerm) unregister(ls *liveSession) {
+	wt.reg.mu.Lock()
+	delete(wt.reg.sessions, ls.info.ID)
+	wt.reg.mu.Unlock()
+	wt.dropShares(ls.info.ID)
+	close(ls.done)
+}
+
+func (wt *WebTerm) lookup(id string) *liveSession {
+	wt.reg.mu.Lock()
+	defer wt.reg.mu.Unlock()
+	return wt.reg.sessions[id]
+}
+
+// Sessions returns the live sessions, oldest first.
+func (wt *WebTerm) Sessions() []SessionInfo {
+	wt.reg.mu.Lock()
+	ret := make([]SessionInfo, 0, len(wt.reg.sessions))
+	for _, ls := range wt.reg.sessions {
+		ls.mu.Lock()
+		info := ls.info
+		info.Clients = len(ls.clients)
+		ls.mu.Unlock()
+		ret = append(ret, info)
+	}
+	wt.reg.mu.Unlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].CreatedAt.Before(ret[j].CreatedAt) })
+	return ret
+}
+
+var ErrSessionNotFound = errors.New("session not found")
+var ErrExportDisabled = errors.New("export disabled")
+
+// Export writes the scrollback and screen of the live session id in the given format,
+// using the terminal theme and font of WebTerm.
+func (wt *WebTerm) Export(w io.Writer, id string, format ExportFormat) error {
+	ls := wt.lookup(id)
+	if ls == nil {
+		return ErrSessionNotFound
+	}
+	if ls.screen == nil {
+		return ErrExportDisabled
+	}
+	return ls.screen.Export(w, format, wt.terminalOptions)
+}
@@ -0,0 +1,87 @@
+package webterm
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// sizeRunner records the sizes its sessions get before and after Open
+type sizeRunner struct {
+	echoRunner
+	mu    sync.Mutex
+	info  SessionInfo
+	sizes []string
+}
+
+func (sr *sizeRunner) Session() (Session, error) {
+	s, _ := sr.echoRunner.Session()
+	return &sizeSession{Session: s, runner: sr}, nil
+}
+
+type sizeSession struct {
+	Session
+	runner *sizeRunner
+}
+
+func (ss *sizeSession) SetSessionInfo(info SessionInfo) {
+	ss.runner.mu.Lock()
+	defer ss.runner.mu.Unlock()
+	ss.runner.info = info
+}
+
+func (ss *sizeSession) SetWinSize(cols, rows int) error {
+	ss.runner.mu.Lock()
+	defer ss.runner.mu.Unlock()
+	ss.runner.sizes = append(ss.runner.sizes, fmt.Sprintf("%dx%d", cols, rows))
+	return nil
+}
+
+func TestInitialWinSize(t *testing.T) {
+	tests := []struct {
+		query      string
+		cols, rows int
+		sizes      []string
+	}{
+		{query: "?cols=120&rows=40", cols: 120, rows: 40, sizes: []string{"120x40", "100x30"}},
+		{query: "", sizes: []string{"100x30"}},
+		{query: "?cols=0&rows=40", sizes: []string{"100x30"}},
+		{query: "?cols=99999&rows=40", sizes: []string{"100x30"}},
+		{query: "?cols=1000&rows=500", cols: 1000, rows: 500, sizes: []string{"1000x500", "100x30"}},
+		{query: "?cols=200&rows=501", sizes: []string{"100x30"}},
+		{query: "?cols=abc&rows=40", sizes: []string{"100x30"}},
+	}
+	for _, tt := range tests {
+		sr := &sizeRunner{}
+		wt := New(sr, WithCutPrefix("/"))
+		srv := httptest.NewServer(wt)
+
+		conn := dialData(t, srv, tt.query)
+		readEvent(t, conn)
+		if s := wt.Sessions(); len(s) != 1 || s[0].Cols != tt.cols || s[0].Rows != tt.rows {
+			t.Errorf("%q: expected session size %dx%d, got %+v", tt.query, tt.cols, tt.rows, s)
+		}
+		// invalid sizes are ignored
+		conn.WriteMessage(websocket.BinaryMessage, []byte("\x00{\"cols\":0,\"rows\":0}"))
+		conn.WriteMessage(websocket.BinaryMessage, []byte("\x00{\"cols\":100,\"rows\":30}"))
+		conn.WriteMessage(websocket.BinaryMessage, []byte("\x01hello"))
+		readOutput(t, conn, "hello")
+		if s := wt.Sessions(); len(s) != 1 || s[0].Cols != 100 || s[0].Rows != 30 {
+			t.Errorf("%q: expected session size 100x30 after resize, got %+v", tt.query, s)
+		}
+		conn.Close()
+		srv.Close()
+
+		sr.mu.Lock()
+		if sr.info.Cols != tt.cols || sr.info.Rows != tt.rows {
+			t.Errorf("%q: expected session info size %dx%d, got %dx%d", tt.query, tt.cols, tt.rows, sr.info.Cols, sr.info.Rows)
+		}
+		if fmt.Sprint(sr.sizes) != fmt.Sprint(tt.sizes) {
+			t.Errorf("%q: expected sizes %q, got %q", tt.query, tt.sizes, sr.sizes)
+		}
+		sr.mu.Unlock()
+	}
+}
@@ -0,0 +1,163 @@
+package webterm
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Share grants the holder of its token to attach to one live session until ExpiresAt.
+type Share struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	ReadOnly  bool      `json:"readOnly"`
+	Token     string    `json:"token,omitempty"`
+	URL       string    `json:"url,omitempty"` // share link relative to the host
+}
+
+var ErrShareNotFound = errors.New("share not found")
+var ErrShareExpired = errors.New("share expired")
+var ErrShareInvalid = errors.New("invalid share token")
+
+// WithShareSecret sets the key that signs the share tokens.
+// If not set, a random key is generated, so tokens do not survive a restart
+// which is fine as the sessions do not survive it either.
+// It is ignored with WithSessionsOf, which keeps the key of the previous WebTerm.
+func WithShareSecret(secret []byte) Option {
+	return func(wt *WebTerm) {
+		wt.shareSecret = secret
+	}
+}
+
+// shareClaims is the signed payload of a share token
+type shareClaims struct {
+	ID       string `json:"jti"`
+	Session  string `json:"sid"`
+	Expires  int64  `json:"exp"`
+	ReadOnly bool   `json:"ro,omitempty"`
+}
+
+func randomSecret() []byte {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return b
+}
+
+// Share issues a token that lets anyone who holds it attach to the live session
+// until ttl has passed. With readOnly the holder sees the session but can not type.
+func (wt *WebTerm) Share(sessionID string, ttl time.Duration, readOnly bool) (Share, error) {
+	if ttl <= 0 {
+		return Share{}, fmt.Errorf("invalid share ttl: %v", ttl)
+	}
+	if wt.lookup(sessionID) == nil {
+		return Share{}, ErrSessionNotFound
+	}
+	share := Share{
+		ID:        newSessionID(),
+		SessionID: sessionID,
+		ExpiresAt: time.Now().Add(ttl).Truncate(time.Second),
+		ReadOnly:  readOnly,
+	}
+	payload, err := json.Marshal(shareClaims{
+		ID:       share.ID,
+		Session:  share.SessionID,
+		Expires:  share.ExpiresAt.Unix(),
+		ReadOnly: share.ReadOnly,
+	})
+	if err != nil {
+		return Share{}, err
+	}
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	share.Token = enc + "." + wt.signShare(enc)
+	share.URL = wt.cutPrefix + "?share=" + share.Token
+
+	wt.reg.sharesMu.Lock()
+	wt.reg.shares[share.ID] = share
+	wt.reg.sharesMu.Unlock()
+	return share, nil
+}
+
+func (wt *WebTerm) signShare(payload string) string {
+	mac := hmac.New(sha256.New, wt.reg.shareSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Shares returns the shares that are not expired or revoked, tokens are omitted.
+func (wt *WebTerm) Shares() []Share {
+	now := time.Now()
+	wt.reg.sharesMu.Lock()
+	ret := make([]Share, 0, len(wt.reg.shares))
+	for id, share := range wt.reg.shares {
+		if now.After(share.ExpiresAt) {
+			delete(wt.reg.shares, id)
+			continue
+		}
+		share.Token, share.URL = "", ""
+		ret = append(ret, share)
+	}
+	wt.reg.sharesMu.Unlock()
+	sort.Slice(ret, func(i, j int) bool { return ret[i].ExpiresAt.Before(ret[j].ExpiresAt) })
+	return ret
+}
+
+// RevokeShare invalidates the share and disconnects the clients attached with it.
+func (wt *WebTerm) RevokeShare(id string) error {
+	wt.reg.sharesMu.Lock()
+	share, ok := wt.reg.shares[id]
+	delete(wt.reg.shares, id)
+	wt.reg.sharesMu.Unlock()
+	if !ok {
+		return ErrShareNotFound
+	}
+	if ls := wt.lookup(share.SessionID); ls != nil {
+		ls.disconnectShare(id)
+	}
+	return nil
+}
+
+// verifyShare checks the signature and the deadline of the token
+// and that the share has not been revoked.
+func (wt *WebTerm) verifyShare(token string) (Share, error) {
+	enc, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(wt.signShare(enc))) {
+		return Share{}, ErrShareInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return Share{}, ErrShareInvalid
+	}
+	claims := shareClaims{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return Share{}, ErrShareInvalid
+	}
+	if time.Now().After(time.Unix(claims.Expires, 0)) {
+		return Share{}, ErrShareExpired
+	}
+	wt.reg.sharesMu.Lock()
+	share, ok := wt.reg.shares[claims.ID]
+	wt.reg.sharesMu.Unlock()
+	if !ok || share.SessionID != claims.Session {
+		return Share{}, ErrShareNotFound
+	}
+	return share, nil
+}
+
+// dropShares removes the shares of a session that has ended
+func (wt *WebTerm) dropShares(sessionID string) {
+	wt.reg.sharesMu.Lock()
+	defer wt.reg.sharesMu.Unlock()
+	for id, share := range wt.reg.shares {
+		if share.SessionID == sessionID {
+			delete(wt.reg.shares, id)
+		}
+	}
+}
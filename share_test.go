@@ -0,0 +1,259 @@
+package webterm
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// echoRunner creates sessions that echo their input as output
+type echoRunner struct{}
+
+func (echoRunner) Session() (Session, error) {
+	r, w := io.Pipe()
+	return &echoSession{r: r, w: w}, nil
+}
+
+func (echoRunner) Template() (*template.Template, any) { return nil, nil }
+
+type echoSession struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func (es *echoSession) Open() error                     { return nil }
+func (es *echoSession) Close() error                    { return es.w.Close() }
+func (es *echoSession) Read(p []byte) (int, error)      { return es.r.Read(p) }
+func (es *echoSession) Write(p []byte) (int, error)     { return es.w.Write(p) }
+func (es *echoSession) SetWinSize(cols, rows int) error { return nil }
+func (es *echoSession) Control(data []byte) error       { return nil }
+
+func dialData(t *testing.T, srv *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/data" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to dial %s: %v", url, err)
+	}
+	return conn
+}
+
+func readEvent(t *testing.T, conn *websocket.Conn) sessionEvent {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	mt, msg, err := conn.ReadMessage()
+	if err != nil || mt != websocket.TextMessage {
+		t.Fatalf("Expected event, got %d %q %v", mt, msg, err)
+	}
+	evt := struct {
+		Type string       `json:"type"`
+		Data sessionEvent `json:"data"`
+	}{}
+	if err := json.Unmarshal(msg, &evt); err != nil || evt.Type != "session" {
+		t.Fatalf("Unexpected event %q: %v", msg, err)
+	}
+	return evt.Data
+}
+
+func readOutput(t *testing.T, conn *websocket.Conn, expect string) {
+	t.Helper()
+	var got bytes.Buffer
+	for !strings.Contains(got.String(), expect) {
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Expected output %q, got %q: %v", expect, got.String(), err)
+		}
+		got.Write(msg)
+	}
+}
+
+func TestShareToken(t *testing.T) {
+	wt := New(echoRunner{}, WithCutPrefix("/"))
+	wt.reg.sessions["s1"] = &liveSession{info: SessionInfo{ID: "s1"}, clients: map[*client]struct{}{}}
+
+	if _, err := wt.Share("unknown", time.Minute, false); err != ErrSessionNotFound {
+		t.Errorf("Expected ErrSessionNotFound, got %v", err)
+	}
+	share, err := wt.Share("s1", time.Minute, true)
+	if err != nil {
+		t.Fatalf("Failed to share: %v", err)
+	}
+	if share.URL != "/?share="+share.Token {
+		t.Errorf("Unexpected share url: %s", share.URL)
+	}
+	verified, err := wt.verifyShare(share.Token)
+	if err != nil || verified.SessionID != "s1" || !verified.ReadOnly {
+		t.Fatalf("Failed to verify share: %+v %v", verified, err)
+	}
+	// tampered payload
+	if _, err := wt.verifyShare("x" + share.Token); err != ErrShareInvalid {
+		t.Errorf("Expected ErrShareInvalid, got %v", err)
+	}
+	// signed with another secret
+	other := New(echoRunner{}, WithShareSecret([]byte("other")))
+	if _, err := other.verifyShare(share.Token); err != ErrShareInvalid {
+		t.Errorf("Expected ErrShareInvalid, got %v", err)
+	}
+	if shares := wt.Shares(); len(shares) != 1 || shares[0].Token != "" {
+		t.Errorf("Unexpected shares: %+v", shares)
+	}
+	if err := wt.RevokeShare(share.ID); err != nil {
+		t.Fatalf("Failed to revoke share: %v", err)
+	}
+	if _, err := wt.verifyShare(share.Token); err != ErrShareNotFound {
+		t.Errorf("Expected ErrShareNotFound, got %v", err)
+	}
+	if err := wt.RevokeShare(share.ID); err != ErrShareNotFound {
+		t.Errorf("Expected ErrShareNotFound, got %v", err)
+	}
+}
+
+func TestShareAttach(t *testing.T) {
+	wt := New(echoRunner{}, WithCutPrefix("/"))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+	admin := httptest.NewServer(wt.AdminHandler())
+	defer admin.Close()
+
+	owner := dialData(t, srv, "")
+	defer owner.Close()
+	info := readEvent(t, owner)
+	owner.WriteMessage(websocket.BinaryMessage, []byte("\x01before share"))
+	readOutput(t, owner, "before share")
+
+	// create a read-only share with the admin API
+	resp, err := http.Post(admin.URL+"/sessions/"+info.ID+"/shares", "application/json",
+		strings.NewReader(`{"ttl":"1m","readOnly":true}`))
+	if err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Failed to create share: %v %v", resp.Status, err)
+	}
+	share := Share{}
+	json.NewDecoder(resp.Body).Decode(&share)
+	resp.Body.Close()
+
+	guest := dialData(t, srv, "?share="+share.Token)
+	defer guest.Close()
+	if evt := readEvent(t, guest); evt.ID != "" || !evt.ReadOnly {
+		t.Errorf("Unexpected guest session event: %+v", evt)
+	}
+	// replay of the screen
+	readOutput(t, guest, "before share")
+
+	// input of a read-only guest is ignored, output of the owner is shared
+	guest.WriteMessage(websocket.BinaryMessage, []byte("\x01from guest"))
+	owner.WriteMessage(websocket.BinaryMessage, []byte("\x01from owner"))
+	readOutput(t, guest, "from owner")
+	if strings.Contains(string(exportText(t, wt, info.ID)), "from guest") {
+		t.Errorf("Read-only guest input was written to the session")
+	}
+
+	// revoking the share disconnects the guest
+	req, _ := http.NewRequest(http.MethodDelete, admin.URL+"/shares/"+share.ID, nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Failed to revoke share: %v %v", resp.Status, err)
+	}
+	guest.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := guest.ReadMessage(); err != nil {
+			break
+		}
+	}
+	if _, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/data?share="+share.Token, nil); err == nil {
+		t.Errorf("Expected revoked share to be rejected")
+	}
+}
+
+func exportText(t *testing.T, wt *WebTerm, id string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := wt.Export(&buf, id, ExportText); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestShareSlowGuest(t *testing.T) {
+	wt := New(echoRunner{}, WithCutPrefix("/"))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	owner := dialData(t, srv, "")
+	defer owner.Close()
+	info := readEvent(t, owner)
+	share, _ := wt.Share(info.ID, time.Minute, false)
+	// the guest does not read, the output fills its socket buffers
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		conn, err := net.Dial(network, addr)
+		if err == nil {
+			conn.(*net.TCPConn).SetReadBuffer(4096)
+		}
+		return conn, err
+	}}
+	guest, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/data?share="+share.Token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer guest.Close()
+	readEvent(t, guest)
+
+	var received atomic.Int64
+	go func() {
+		for {
+			_, msg, err := owner.ReadMessage()
+			if err != nil {
+				return
+			}
+			received.Add(int64(len(msg)))
+		}
+	}()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		input := append([]byte{1}, bytes.Repeat([]byte("x"), 4096)...)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := owner.WriteMessage(websocket.BinaryMessage, input); err != nil {
+				return
+			}
+		}
+	}()
+	// the output stops, it waits for the guest
+	deadline := time.Now().Add(5 * time.Second)
+	for last, idle := int64(-1), 0; idle < 6; {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the guest to stall the output")
+		}
+		time.Sleep(50 * time.Millisecond)
+		if n := received.Load(); n == last {
+			idle++
+		} else {
+			last, idle = n, 0
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		wt.Sessions()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the sessions to be listed while the guest stalls the output")
+	}
+}
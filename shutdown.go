@@ -0,0 +1,97 @@
+package webterm
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var ErrShutdown = errors.New("webterm is shutting down")
+
+// acquire registers a websocket handler, it returns false
+// once Shutdown has been called.
+func (wt *WebTerm) acquire() bool {
+	wt.reg.mu.Lock()
+	defer wt.reg.mu.Unlock()
+	if wt.reg.closing {
+		return false
+	}
+	wt.reg.handlers.Add(1)
+	return true
+}
+
+// shutdownCloseWait bounds the wait for the sessions closed by Shutdown after the deadline
+var shutdownCloseWait = 5 * time.Second
+
+// Shutdown gracefully stops the WebTerm.
+// It stops accepting new sessions, prints the shutdown notice into every
+// live terminal and waits until all sessions have ended by themselves or ctx is done.
+// Then the remaining sessions are closed and their websockets receive
+// a "service restart" close frame, so the browser knows to reconnect later.
+// Shutdown returns nil when all sessions have ended before ctx is done, otherwise
+// ctx.Err() after the remaining sessions are closed, or after a few seconds
+// if a session does not close.
+func (wt *WebTerm) Shutdown(ctx context.Context) error {
+	wt.reg.mu.Lock()
+	if !wt.reg.closing {
+		wt.reg.closing = true
+		close(wt.reg.shutdownCh)
+	}
+	wt.reg.mu.Unlock()
+	sessions := wt.reg.list()
+
+	slog.Info("webterm shutting down", "sessions", len(sessions))
+	if wt.shutdownNotice != "" {
+		notice := []byte("\r\n" + ColorYellow + wt.shutdownNotice + ColorReset + "\r\n")
+		for _, ls := range sessions {
+			ls.broadcast(notice)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wt.reg.handlers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	sessions = wt.reg.list()
+	for _, ls := range sessions {
+		ls.closeClientsWith(websocket.CloseServiceRestart, "server shutdown")
+		// a session may take its time to end, e.g. webexec grace periods
+		go func() {
+			if err := ls.session.Close(); err != nil {
+				slog.Error("webterm failed to close session", "id", ls.info.ID, "error", err)
+			}
+		}()
+	}
+	select {
+	case <-done:
+		slog.Info("webterm shutdown complete", "closed", len(sessions))
+	case <-time.After(shutdownCloseWait):
+		slog.Warn("webterm shutdown gave up waiting for the sessions", "closed", len(sessions))
+	}
+	return ctx.Err()
+}
+
+// closeClientsWith sends a close frame to all clients and disconnects them
+func (ls *liveSession) closeClientsWith(code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	ls.mu.Lock()
+	clients := ls.clientList()
+	clear(ls.clients)
+	ls.mu.Unlock()
+	for _, c := range clients {
+		c.wmu.Lock()
+		c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		c.wmu.Unlock()
+		c.close()
+	}
+}
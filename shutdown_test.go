@@ -0,0 +1,202 @@
+package webterm
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShutdown(t *testing.T) {
+	wt := New(echoRunner{}, WithCutPrefix("/"), WithShutdownNotice("bye bye"))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	conn := dialData(t, srv, "")
+	defer conn.Close()
+	readEvent(t, conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- wt.Shutdown(ctx)
+	}()
+
+	readOutput(t, conn, "bye bye")
+
+	// new sessions are rejected
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/data", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected new session to be rejected, got %v", err)
+	}
+
+	// the live session is closed with a close frame after the deadline
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+			t.Errorf("Expected service restart close frame, got %v", err)
+		}
+		break
+	}
+	select {
+	case err := <-shutdownErr:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the deadline error of the context, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+	if n := len(wt.Sessions()); n != 0 {
+		t.Errorf("Expected no sessions after shutdown, got %d", n)
+	}
+}
+
+func TestShutdownIdle(t *testing.T) {
+	wt := New(echoRunner{})
+	start := time.Now()
+	if err := wt.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("Shutdown without sessions should return immediately")
+	}
+}
+
+// hangRunner has sessions whose Close blocks until release is closed
+type hangRunner struct {
+	release chan struct{}
+}
+
+func (hr hangRunner) Session() (Session, error) {
+	r, w := io.Pipe()
+	return &hangSession{echoSession{r: r, w: w}, hr.release}, nil
+}
+
+func (hangRunner) Template() (*template.Template, any) { return nil, nil }
+
+type hangSession struct {
+	echoSession
+	release chan struct{}
+}
+
+func (hs *hangSession) Close() error {
+	<-hs.release
+	return hs.echoSession.Close()
+}
+
+func TestShutdownHungSession(t *testing.T) {
+	defer func(d time.Duration) { shutdownCloseWait = d }(shutdownCloseWait)
+	shutdownCloseWait = 100 * time.Millisecond
+	release := make(chan struct{})
+	defer close(release)
+	wt := New(hangRunner{release}, WithCutPrefix("/"))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	conn := dialData(t, srv, "")
+	defer conn.Close()
+	readEvent(t, conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := wt.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline error of the context, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected Shutdown to give up on the hung session, took %s", d)
+	}
+}
+
+// gateRunner has sessions whose Open signals opening and waits for the gate
+type gateRunner struct {
+	opening chan struct{}
+	gate    chan struct{}
+	closed  chan struct{}
+}
+
+func (gr gateRunner) Session() (Session, error) {
+	r, w := io.Pipe()
+	return &gateSession{echoSession{r: r, w: w}, gr}, nil
+}
+
+func (gateRunner) Template() (*template.Template, any) { return nil, nil }
+
+type gateSession struct {
+	echoSession
+	gr gateRunner
+}
+
+func (gs *gateSession) Open() error {
+	close(gs.gr.opening)
+	<-gs.gr.gate
+	return nil
+}
+
+func (gs *gateSession) Close() error {
+	select {
+	case <-gs.gr.closed:
+	default:
+		close(gs.gr.closed)
+	}
+	return gs.echoSession.Close()
+}
+
+func TestShutdownOpening(t *testing.T) {
+	gr := gateRunner{opening: make(chan struct{}), gate: make(chan struct{}), closed: make(chan struct{})}
+	wt := New(gr, WithCutPrefix("/"))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	conn := dialData(t, srv, "")
+	defer conn.Close()
+	<-gr.opening
+
+	// the handler passed acquire before Shutdown, its session opens after it
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- wt.Shutdown(context.Background())
+	}()
+	<-wt.reg.shutdownCh
+	close(gr.gate)
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseServiceRestart) {
+			t.Errorf("Expected service restart close frame, got %v", err)
+		}
+		break
+	}
+	select {
+	case err := <-shutdownErr:
+		if err != nil {
+			t.Errorf("Expected Shutdown to succeed, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Shutdown did not return")
+	}
+	select {
+	case <-gr.closed:
+	default:
+		t.Errorf("Expected the session to be closed")
+	}
+	if n := len(wt.Sessions()); n != 0 {
+		t.Errorf("Expected no sessions after shutdown, got %d", n)
+	}
+}
@@ -1,4 +1,6 @@
-function WebTerm(id, options = {}) {
+// WebTerm connects a terminal in the element id to a WebTerm endpoint.
+// base is the URL of the WebTerm page, the current page if omitted.
+function WebTerm(id, options = {}, base = null) {
     // Create a new terminal instance
     const term = new Terminal(options);
 
@@ -14,54 +16,143 @@ function WebTerm(id, options = {}) {
 
     // WebSocket connection management
     let ws = null;
+    const encoder = new TextEncoder();
     // Send terminal input to server via WebSocket
     term.send = (code, data) => {
         if (ws && ws.readyState === WebSocket.OPEN) {
-            var buf = new Uint8Array(1 + data.length);
+            const payload = encoder.encode(data);
+            var buf = new Uint8Array(1 + payload.length);
             buf[0] = code;
-            buf.set(new Uint8Array(data.split('').map(c => c.charCodeAt(0))), 1);
+            buf.set(payload, 1);
             ws.send(buf);
         } else {
             console.log("WebSocket is not open. Unable to send data.");
         }
     }
 
+    // Server events, sent as text frames: { type: "...", data: ... }
+    const eventHandlers = {};
+    term.onEvent = (type, handler) => {
+        (eventHandlers[type] = eventHandlers[type] || []).push(handler);
+    };
+    term.onEvent("session", (info) => {
+        term.sessionID = info.id;
+        term.macros = info.macros || [];
+        if (info.readOnly) {
+            term.options.disableStdin = true;
+        }
+    });
+
+    const baseURL = new URL(base || window.location.href, window.location.href);
+    // Run a macro declared by the server, the server sends its input to the session
+    term.runMacro = (name) => {
+        term.send(2, JSON.stringify({ macro: name }));
+    };
+
+    // Title (OSC 0/2) and working directory (OSC 7) of the session
+    term.onEvent("title", (info) => {
+        term.sessionTitle = info.title;
+        term.sessionCwd = info.cwd;
+    });
+
+    // OSC 52 clipboard requests of the session, allowed by the clipboard policy of the server
+    const toBase64 = (text) => {
+        let bin = "";
+        encoder.encode(text).forEach((b) => { bin += String.fromCharCode(b); });
+        return btoa(bin);
+    };
+    term.onEvent("clipboard", (req) => {
+        if (!navigator.clipboard) {
+            console.log("Clipboard is not available, it requires a secure context.");
+            return;
+        }
+        if (req.op === "write") {
+            if (req.ask && !window.confirm(`Allow the terminal to copy ${req.text.length} characters to the clipboard?`)) {
+                return;
+            }
+            navigator.clipboard.writeText(req.text || "").catch((e) => console.log("Clipboard write failed:", e));
+        } else if (req.op === "read") {
+            if (req.ask && !window.confirm("Allow the terminal to read the clipboard?")) {
+                return;
+            }
+            navigator.clipboard.readText().then((text) => {
+                term.send(1, `\x1b]52;${req.selection || "c"};${toBase64(text)}\x07`);
+            }).catch((e) => console.log("Clipboard read failed:", e));
+        }
+    });
+
+    // A share link (?share=<token>) attaches to the session of the token
+    const shareToken = baseURL.searchParams.get("share");
+
+    // URL of the screen and scrollback export of this session, format: html, svg or text
+    term.exportURL = (format = "html", download = false) => {
+        let url = `${baseURL.pathname}export?format=${encodeURIComponent(format)}`;
+        if (shareToken) {
+            url += `&share=${encodeURIComponent(shareToken)}`;
+        } else if (term.sessionID) {
+            url += `&session=${encodeURIComponent(term.sessionID)}`;
+        } else {
+            return null;
+        }
+        if (download) {
+            url += "&download";
+        }
+        return url;
+    };
+
+    // Attach terminal to the DOM
+    let container = document.getElementById(id);
+    term.open(container);
+    container.style.backgroundColor = options.theme.background;
+
     (() => {
         // Build WebSocket URL with filter and selected parameters
-        const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        let url = `${protocol}//${window.location.host}${window.location.pathname}data`;
+        const protocol = baseURL.protocol === 'https:' ? 'wss:' : 'ws:';
+        // Fit terminal to container, the session starts with this size
+        fitAddon.fit();
+        // The query of the page is passed on to the runner, e.g. ?command=psql
+        const params = new URLSearchParams(baseURL.search);
+        params.set("cols", term.cols);
+        params.set("rows", term.rows);
+        let url = `${protocol}//${baseURL.host}${baseURL.pathname}data?${params}`;
 
         // Connect to WebSocket endpoint
         ws = new WebSocket(url);
+        ws.binaryType = "arraybuffer";
         ws.onopen = () => {
             // Fit terminal to container
             fitAddon.fit();
             // Send initial terminal size
             term.send(0, JSON.stringify({ cols: term.cols, rows: term.rows }));
         };
-        //ws.onmessage = (event) => {
-            //term.write(event.data);
-        //};
+        ws.onmessage = (event) => {
+            if (typeof event.data === "string") {
+                let evt;
+                try {
+                    evt = JSON.parse(event.data);
+                } catch (e) {
+                    console.log("Invalid server event:", event.data);
+                    return;
+                }
+                (eventHandlers[evt.type] || []).forEach((handler) => handler(evt.data));
+                return;
+            }
+            term.write(new Uint8Array(event.data));
+        };
         ws.onerror = (error) => {
             console.log("WebSocket error:", error);
             term.writeln('\x1b[31mConnection error.\x1b[0m');
         };
-        ws.onclose = () => {
+        ws.onclose = (event) => {
+            if (event.code === 1012) {
+                // service restart, sent by WebTerm.Shutdown
+                term.writeln('\x1b[33mServer is restarting, please reconnect later.\x1b[0m');
+                return;
+            }
             term.writeln('\x1b[33mConnection closed.\x1b[0m');
         };
     })();
 
-    // Create fit addon instance
-    const attachAddon = new window.AttachAddon.AttachAddon(ws);
-
-    // Load addon into terminal
-    term.loadAddon(attachAddon);
-
-    // Attach terminal to the DOM
-    let container = document.getElementById(id);
-    term.open(container);
-    container.style.backgroundColor = options.theme.background;
-
     // Refit on window resize with debounce
     let resizeTimeout;
     window.addEventListener('resize', () => {
@@ -85,4 +176,4 @@ function WebTerm(id, options = {}) {
     });
 
     return term;
-}
\ No newline at end of file
+}
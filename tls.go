@@ -0,0 +1,134 @@
+package webterm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// TLSOptions configures the TLS of a server.
+type TLSOptions struct {
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+	// SelfSigned generates a self-signed certificate for development
+	// if CertFile and KeyFile are not set.
+	SelfSigned bool `json:"selfSigned,omitempty"`
+	// Hosts are the names and IP addresses of the self-signed certificate,
+	// localhost, 127.0.0.1 and ::1 if empty.
+	Hosts []string `json:"hosts,omitempty"`
+	// ClientCAFile turns mutual TLS on, clients must present a certificate
+	// signed by one of the CAs in this PEM file.
+	ClientCAFile string `json:"clientCAFile,omitempty"`
+}
+
+// Validate checks the options without loading the files
+func (o *TLSOptions) Validate() error {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return errors.New("tls requires both certFile and keyFile")
+	}
+	if o.CertFile == "" && !o.SelfSigned {
+		return errors.New("tls requires certFile and keyFile, or selfSigned")
+	}
+	return nil
+}
+
+// Config loads the certificates and returns the tls.Config of a server.
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	var cert tls.Certificate
+	var err error
+	if o.CertFile != "" {
+		cert, err = tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	} else {
+		cert, err = SelfSignedCertificate(o.Hosts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if o.ClientCAFile != "" {
+		pem, err := os.ReadFile(o.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", o.ClientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// SelfSignedCertificate generates a certificate for the hosts valid for one year,
+// hosts can be names or IP addresses, localhost, 127.0.0.1 and ::1 if empty.
+// Browsers warn about it, use it only for development.
+func SelfSignedCertificate(hosts ...string) (tls.Certificate, error) {
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"webterm self-signed"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+var ErrNoClientCert = errors.New("no verified client certificate")
+
+// AuthenticateClientCert is an Authenticator for mutual TLS. The principal is the subject
+// of the verified client certificate: the common name, or the whole subject if it has none,
+// with the organizational units as roles.
+func AuthenticateClientCert(r *http.Request) (Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return Principal{}, ErrNoClientCert
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	name := subject.CommonName
+	if name == "" {
+		name = subject.String()
+	}
+	return Principal{Name: name, Roles: subject.OrganizationalUnit}, nil
+}
+
+var _ Authenticator = AuthenticateClientCert
@@ -0,0 +1,99 @@
+package webterm
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTLSOptionsValidate(t *testing.T) {
+	tests := []struct {
+		opts TLSOptions
+		ok   bool
+	}{
+		{TLSOptions{CertFile: "cert.pem", KeyFile: "key.pem"}, true},
+		{TLSOptions{SelfSigned: true}, true},
+		{TLSOptions{CertFile: "cert.pem"}, false},
+		{TLSOptions{ClientCAFile: "ca.pem"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v expected ok=%v, got %v", tt.opts, tt.ok, err)
+		}
+	}
+}
+
+func TestClientCertPrincipal(t *testing.T) {
+	// a client CA and a client certificate signed by it
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	caCert, _ := x509.ParseCertificate(caDER)
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	clientTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"dev"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, _ := x509.CreateCertificate(rand.Reader, clientTmpl, caCert, &clientKey.PublicKey, caKey)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o644)
+	opts := TLSOptions{SelfSigned: true, ClientCAFile: caFile}
+	cfg, err := opts.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := AuthenticateClientCert(r)
+		if err != nil || p.Name != "alice" || !p.HasRole("dev") {
+			t.Errorf("Unexpected principal %+v %v", p, err)
+		}
+	}))
+	srv.TLS = cfg
+	srv.StartTLS()
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}},
+	}}}
+	rsp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Failed with client certificate: %v", err)
+	}
+	rsp.Body.Close()
+
+	// without a client certificate the handshake fails
+	insecure := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	if rsp, err := insecure.Get(srv.URL); err == nil {
+		rsp.Body.Close()
+		t.Errorf("Expected the request without a client certificate to fail")
+	}
+	if _, err := AuthenticateClientCert(httptest.NewRequest("GET", "/", nil)); err != ErrNoClientCert {
+		t.Errorf("Expected ErrNoClientCert, got %v", err)
+	}
+}
@@ -0,0 +1,242 @@
+// Package webclient is a Go client of the WebTerm websocket protocol.
+// It dials the "data" URL of a WebTerm and exposes the session as an io.ReadWriteCloser.
+package webclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/gorilla/websocket"
+)
+
+// opcodes of the messages from the client to the server, see pumpStdin of WebTerm
+const (
+	opResize  = 0
+	opData    = 1
+	opControl = 2
+)
+
+// Event is a server event, sent as a text message
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// SessionEvent is the data of the first event of a connection
+type SessionEvent struct {
+	webterm.SessionInfo
+	ReadOnly  bool      `json:"readOnly,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+}
+
+type Option func(*Client)
+
+// WithHeader sets the headers of the websocket handshake, e.g. Authorization
+func WithHeader(header http.Header) Option {
+	return func(c *Client) {
+		c.header = header
+	}
+}
+
+// WithDialer replaces websocket.DefaultDialer, e.g. for TLS client certificates
+func WithDialer(dialer *websocket.Dialer) Option {
+	return func(c *Client) {
+		c.dialer = dialer
+	}
+}
+
+// WithSize sets the initial window size, the size the command of a new session starts with.
+// It is also sent right after connecting, for sessions attached with a share token.
+func WithSize(cols, rows int) Option {
+	return func(c *Client) {
+		c.cols, c.rows = cols, rows
+	}
+}
+
+// WithEventHandler sets the handler of the server events, it is called from Read.
+func WithEventHandler(fn func(Event)) Option {
+	return func(c *Client) {
+		c.onEvent = fn
+	}
+}
+
+var _ io.ReadWriteCloser = (*Client)(nil)
+
+// Client is a connection to a WebTerm session.
+// Read returns the terminal output, Write sends input.
+type Client struct {
+	conn    *websocket.Conn
+	header  http.Header
+	dialer  *websocket.Dialer
+	cols    int
+	rows    int
+	onEvent func(Event)
+
+	wmu     sync.Mutex
+	rmu     sync.Mutex
+	rbuf    bytes.Buffer
+	infoMu  sync.Mutex
+	info    SessionEvent
+	infoSet chan struct{}
+}
+
+// Dial connects to the data URL of a WebTerm, e.g. "ws://host/terminal/data".
+// http and https URLs are dialed as ws and wss, a share link is dialed with its "share" query.
+func Dial(ctx context.Context, url string, opts ...Option) (*Client, error) {
+	c := &Client{dialer: websocket.DefaultDialer, infoSet: make(chan struct{})}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if rest, ok := strings.CutPrefix(url, "http"); ok {
+		url = "ws" + rest
+	}
+	if c.cols > 0 && c.rows > 0 {
+		sep := "?"
+		if strings.Contains(url, "?") {
+			sep = "&"
+		}
+		url += fmt.Sprintf("%scols=%d&rows=%d", sep, c.cols, c.rows)
+	}
+	conn, rsp, err := c.dialer.DialContext(ctx, url, c.header)
+	if err != nil {
+		if rsp != nil {
+			return nil, &HandshakeError{StatusCode: rsp.StatusCode, Err: err}
+		}
+		return nil, err
+	}
+	c.conn = conn
+	if c.cols > 0 && c.rows > 0 {
+		if err := c.Resize(c.cols, c.rows); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// HandshakeError is returned by Dial when the server refused the websocket,
+// e.g. 401 for failed authentication or 503 while shutting down.
+type HandshakeError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *HandshakeError) Error() string {
+	return http.StatusText(e.StatusCode) + ": " + e.Err.Error()
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// Read reads the terminal output. It returns io.EOF when the session ended normally,
+// or a *websocket.CloseError with the reason, e.g. websocket.CloseTryAgainLater for session limits,
+// and websocket.CloseAbnormalClosure when the connection dropped.
+func (c *Client) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+	for c.rbuf.Len() == 0 {
+		mt, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if mt == websocket.TextMessage {
+			c.event(msg)
+			continue
+		}
+		c.rbuf.Write(msg)
+	}
+	return c.rbuf.Read(p)
+}
+
+func (c *Client) event(msg []byte) {
+	var evt Event
+	if err := json.Unmarshal(msg, &evt); err != nil {
+		return
+	}
+	if evt.Type == "session" {
+		c.infoMu.Lock()
+		json.Unmarshal(evt.Data, &c.info)
+		select {
+		case <-c.infoSet:
+		default:
+			close(c.infoSet)
+		}
+		c.infoMu.Unlock()
+	}
+	if c.onEvent != nil {
+		c.onEvent(evt)
+	}
+}
+
+// Session returns the session event of the connection, it waits until Read received it or ctx is done.
+// Clients attached with a share link get no session ID.
+func (c *Client) Session(ctx context.Context) (SessionEvent, error) {
+	select {
+	case <-c.infoSet:
+	case <-ctx.Done():
+		return SessionEvent{}, ctx.Err()
+	}
+	c.infoMu.Lock()
+	defer c.infoMu.Unlock()
+	return c.info, nil
+}
+
+// Write sends input to the session
+func (c *Client) Write(p []byte) (int, error) {
+	if err := c.send(opData, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Resize sets the window size of the session
+func (c *Client) Resize(cols, rows int) error {
+	b, _ := json.Marshal(struct {
+		Cols int `json:"cols"`
+		Rows int `json:"rows"`
+	}{cols, rows})
+	return c.send(opResize, b)
+}
+
+// Control sends a control message to the Session of the runner, e.g. the filter of webtail
+func (c *Client) Control(data []byte) error {
+	return c.send(opControl, data)
+}
+
+// RunMacro runs a macro declared by the server with webterm.WithMacros,
+// the request is dropped while another macro of the session is running.
+func (c *Client) RunMacro(name string) error {
+	b, _ := json.Marshal(struct {
+		Macro string `json:"macro"`
+	}{name})
+	return c.send(opControl, b)
+}
+
+func (c *Client) send(op byte, data []byte) error {
+	msg := make([]byte, 1+len(data))
+	msg[0] = op
+	copy(msg[1:], data)
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.conn.WriteMessage(websocket.BinaryMessage, msg)
+}
+
+// Close ends the connection, which ends the session if the client is its owner.
+func (c *Client) Close() error {
+	c.wmu.Lock()
+	c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.wmu.Unlock()
+	return c.conn.Close()
+}
@@ -0,0 +1,189 @@
+package webclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/gorilla/websocket"
+)
+
+// echoRunner echoes the input and reports window sizes and control messages as output
+type echoRunner struct{}
+
+func (echoRunner) Session() (webterm.Session, error) {
+	r, w := io.Pipe()
+	return &echoSession{r: r, w: w}, nil
+}
+
+func (echoRunner) Template() (*template.Template, any) { return nil, nil }
+
+type echoSession struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func (es *echoSession) Open() error                 { return nil }
+func (es *echoSession) Close() error                { return es.w.Close() }
+func (es *echoSession) Read(p []byte) (int, error)  { return es.r.Read(p) }
+func (es *echoSession) Write(p []byte) (int, error) { return es.w.Write(p) }
+func (es *echoSession) SetWinSize(cols, rows int) error {
+	_, err := fmt.Fprintf(es.w, "[size %dx%d]", cols, rows)
+	return err
+}
+func (es *echoSession) Control(data []byte) error {
+	_, err := fmt.Fprintf(es.w, "[control %s]", data)
+	return err
+}
+
+func readUntil(t *testing.T, r io.Reader, expect string) {
+	t.Helper()
+	var out strings.Builder
+	buf := make([]byte, 1024)
+	for !strings.Contains(out.String(), expect) {
+		n, err := r.Read(buf)
+		out.Write(buf[:n])
+		if err != nil {
+			t.Fatalf("Expected %q, got %q %v", expect, out.String(), err)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	wt := webterm.New(echoRunner{}, webterm.WithCutPrefix("/term/"),
+		webterm.WithMacros(webterm.Macro{Name: "hi", Text: "[macro]"}))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var events []string
+	c, err := Dial(ctx, srv.URL+"/term/data", WithSize(100, 30), WithEventHandler(func(evt Event) {
+		events = append(events, evt.Type)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	readUntil(t, c, "[size 100x30]")
+	info, err := c.Session(ctx)
+	if err != nil || info.ID == "" {
+		t.Errorf("Expected the session info, got %+v %v", info, err)
+	}
+	if len(events) != 1 || events[0] != "session" {
+		t.Errorf("Expected the session event, got %v", events)
+	}
+	fmt.Fprint(c, "hello")
+	readUntil(t, c, "hello")
+	c.Resize(120, 40)
+	readUntil(t, c, "[size 120x40]")
+	c.Control([]byte("ping"))
+	readUntil(t, c, "[control ping]")
+	c.RunMacro("hi")
+	readUntil(t, c, "[macro]")
+
+	if sessions := wt.Sessions(); len(sessions) != 1 || sessions[0].ID != info.ID {
+		t.Errorf("Unexpected sessions %+v", sessions)
+	}
+	c.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(wt.Sessions()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := len(wt.Sessions()); n != 0 {
+		t.Errorf("Expected the session to end with the client, got %d", n)
+	}
+}
+
+func TestClientRejected(t *testing.T) {
+	wt := webterm.New(echoRunner{}, webterm.WithCutPrefix("/"),
+		webterm.WithAuthenticator(func(r *http.Request) (webterm.Principal, error) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return webterm.Principal{}, errors.New("unauthorized")
+			}
+			return webterm.Principal{Name: "bot"}, nil
+		}),
+		webterm.WithLimits(webterm.Limits{MaxSessions: 1}))
+	srv := httptest.NewServer(wt)
+	defer srv.Close()
+	ctx := context.Background()
+
+	_, err := Dial(ctx, srv.URL+"/data")
+	var he *HandshakeError
+	if !errors.As(err, &he) || he.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 handshake error, got %v", err)
+	}
+	auth := WithHeader(http.Header{"Authorization": {"Bearer secret"}})
+	first, err := Dial(ctx, srv.URL+"/data", auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	for len(wt.Sessions()) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	second, err := Dial(ctx, srv.URL+"/data", auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	_, err = io.ReadAll(second)
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("Expected the session limit close error, got %v", err)
+	}
+}
+
+// byeSession prints "bye" and ends, it is its own runner
+type byeSession struct {
+	*strings.Reader
+}
+
+func (byeSession) Session() (webterm.Session, error) {
+	return byeSession{strings.NewReader("bye")}, nil
+}
+
+func (byeSession) Template() (*template.Template, any) { return nil, nil }
+func (byeSession) Open() error                         { return nil }
+func (byeSession) Close() error                        { return nil }
+func (byeSession) Write(p []byte) (int, error)         { return len(p), nil }
+func (byeSession) SetWinSize(cols, rows int) error     { return nil }
+func (byeSession) Control(data []byte) error           { return nil }
+
+func TestClientEnd(t *testing.T) {
+	srv := httptest.NewServer(webterm.New(byeSession{}, webterm.WithCutPrefix("/")))
+	defer srv.Close()
+	c, err := Dial(context.Background(), srv.URL+"/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if out, err := io.ReadAll(c); err != nil || string(out) != "bye" {
+		t.Errorf("Expected the output and io.EOF when the session ends, got %q %v", out, err)
+	}
+
+	// a connection dropped without a close frame is an error
+	var upgrader websocket.Upgrader
+	drop := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if conn, err := upgrader.Upgrade(w, r, nil); err == nil {
+			conn.NetConn().Close()
+		}
+	}))
+	defer drop.Close()
+	c, err = Dial(context.Background(), drop.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := io.ReadAll(c); !websocket.IsCloseError(err, websocket.CloseAbnormalClosure) {
+		t.Errorf("Expected the abnormal closure, got %v", err)
+	}
+}
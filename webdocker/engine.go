@@ -0,0 +1,266 @@
+package webdocker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiVersion of the Docker Engine API, supported since Docker 20.10
+const apiVersion = "/v1.41"
+
+// DefaultHost is the Docker daemon if WebDocker.Host and DOCKER_HOST are empty
+const DefaultHost = "unix:///var/run/docker.sock"
+
+// engine is a client of the Docker Engine API
+type engine struct {
+	network string
+	addr    string
+	http    *http.Client
+}
+
+var (
+	enginesMu sync.Mutex
+	engines   = map[string]*engine{}
+)
+
+// engineOf returns the engine of the host, the sessions of a daemon share its connections
+func engineOf(host string) (*engine, error) {
+	host = resolveHost(host)
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+	if e, ok := engines[host]; ok {
+		return e, nil
+	}
+	e, err := newEngine(host)
+	if err != nil {
+		return nil, err
+	}
+	engines[host] = e
+	return e, nil
+}
+
+// resolveHost returns the host, DOCKER_HOST or DefaultHost
+func resolveHost(host string) string {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = DefaultHost
+	}
+	return host
+}
+
+func newEngine(host string) (*engine, error) {
+	host = resolveHost(host)
+	e := &engine{}
+	if path, ok := strings.CutPrefix(host, "unix://"); ok {
+		e.network, e.addr = "unix", path
+	} else if addr, ok := strings.CutPrefix(host, "tcp://"); ok {
+		e.network, e.addr = "tcp", addr
+	} else {
+		return nil, fmt.Errorf("webdocker unsupported host %q, expected unix:// or tcp://", host)
+	}
+	e.http = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return e.dial(ctx)
+		},
+	}}
+	return e, nil
+}
+
+func (e *engine) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, e.network, e.addr)
+}
+
+// APIError is an error response of the Docker daemon, e.g. 404 for an unknown container
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("docker: %s (%d)", e.Message, e.StatusCode)
+}
+
+func (e *engine) newRequest(ctx context.Context, method, path string, body any) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	// the host is not used to connect, it has to be a valid one
+	req, err := http.NewRequestWithContext(ctx, method, "http://docker"+apiVersion+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// do sends the request and decodes the JSON response into out, if not nil
+func (e *engine) do(ctx context.Context, method, path string, body, out any) error {
+	req, err := e.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	rsp, err := e.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer rsp.Body.Close()
+	if err := checkResponse(rsp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(rsp.Body).Decode(out)
+}
+
+func checkResponse(rsp *http.Response) error {
+	if rsp.StatusCode < 300 {
+		return nil
+	}
+	msg := struct {
+		Message string `json:"message"`
+	}{}
+	b, _ := io.ReadAll(io.LimitReader(rsp.Body, 64<<10))
+	if json.Unmarshal(b, &msg) != nil || msg.Message == "" {
+		msg.Message = strings.TrimSpace(string(b))
+	}
+	return &APIError{StatusCode: rsp.StatusCode, Message: msg.Message}
+}
+
+// Container is a running container
+type Container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"` // with a leading "/"
+	Image  string            `json:"Image"`
+	Status string            `json:"Status"` // e.g. "Up 2 hours"
+	Labels map[string]string `json:"Labels,omitempty"`
+}
+
+// Name is the first name of the container without the leading "/"
+func (c Container) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// match reports whether the container is the one of the name or ID, or a prefix of at least 12 of the ID
+func (c Container) match(s string) bool {
+	if s == "" {
+		return false
+	}
+	if len(s) >= 12 && strings.HasPrefix(c.ID, s) {
+		return true
+	}
+	for _, n := range c.Names {
+		if strings.TrimPrefix(n, "/") == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *engine) containers(ctx context.Context, labels []string) ([]Container, error) {
+	path := "/containers/json"
+	if len(labels) > 0 {
+		filters, _ := json.Marshal(map[string][]string{"label": labels})
+		path += "?filters=" + url.QueryEscape(string(filters))
+	}
+	var ret []Container
+	if err := e.do(ctx, "GET", path, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// execConfig is the body of POST /containers/{id}/exec
+type execConfig struct {
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	Tty          bool
+	ConsoleSize  *[2]uint `json:",omitempty"` // height, width
+	Env          []string `json:",omitempty"`
+	Cmd          []string
+	User         string `json:",omitempty"`
+	WorkingDir   string `json:",omitempty"`
+}
+
+func (e *engine) execCreate(ctx context.Context, container string, cfg execConfig) (string, error) {
+	var rsp struct {
+		ID string `json:"Id"`
+	}
+	if err := e.do(ctx, "POST", "/containers/"+url.PathEscape(container)+"/exec", cfg, &rsp); err != nil {
+		return "", err
+	}
+	return rsp.ID, nil
+}
+
+// execStart starts the exec and hijacks the connection, which is the TTY of the command then.
+// The reader returns the output buffered with the response.
+func (e *engine) execStart(ctx context.Context, id string, consoleSize *[2]uint) (net.Conn, io.Reader, error) {
+	req, err := e.newRequest(ctx, "POST", "/exec/"+url.PathEscape(id)+"/start",
+		struct {
+			Detach      bool
+			Tty         bool
+			ConsoleSize *[2]uint `json:",omitempty"`
+		}{Tty: true, ConsoleSize: consoleSize})
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	conn, err := e.dial(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the ctx covers only the dial, the handshake has the deadline of the ctx
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(apiTimeout)
+	}
+	conn.SetDeadline(deadline)
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	br := bufio.NewReader(conn)
+	rsp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if rsp.StatusCode != http.StatusSwitchingProtocols && rsp.StatusCode != http.StatusOK {
+		err := checkResponse(rsp)
+		rsp.Body.Close()
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, br, nil
+}
+
+func (e *engine) execResize(ctx context.Context, id string, cols, rows int) error {
+	return e.do(ctx, "POST", fmt.Sprintf("/exec/%s/resize?h=%d&w=%d", url.PathEscape(id), rows, cols), nil, nil)
+}
@@ -0,0 +1,221 @@
+// Package webdocker is a runner of commands in Docker containers, like "docker exec -it <container> sh".
+// It talks to the Docker Engine API, usually over the Unix socket of the daemon.
+package webdocker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+)
+
+var _ webterm.Runner = (*WebDocker)(nil)
+var _ webterm.Session = (*WebDockerSession)(nil)
+var _ webterm.SessionInfoSetter = (*WebDockerSession)(nil)
+
+// WebDocker runs Command in a running container with a TTY.
+// The container is Container, or the one of the "container" query of the page,
+// e.g. "/docker/?container=web", otherwise the user picks it from the running containers.
+type WebDocker struct {
+	// Host is the Docker daemon, "unix:///var/run/docker.sock" or "tcp://host:2375",
+	// DOCKER_HOST or DefaultHost if empty
+	Host      string
+	Container string // name or ID
+	// Labels limits the containers of the query and the picker, "key" or "key=value".
+	// They do not apply to Container.
+	Labels     []string
+	Command    []string // DefaultCommand if empty
+	User       string   // user in the container, the one of the image if empty
+	WorkingDir string
+	Env        []string // "KEY=value", WEBTERM_SESSION_ID and WEBTERM_USER are always set
+}
+
+var DefaultCommand = []string{"sh"}
+
+// apiTimeout limits the API calls other than the stream of the exec
+var apiTimeout = 10 * time.Second
+
+var ErrNoContainer = errors.New("webdocker has no running container")
+
+func (wd *WebDocker) Session() (webterm.Session, error) {
+	return &WebDockerSession{WebDocker: *wd}, nil
+}
+
+func (wd *WebDocker) Template() (*template.Template, any) {
+	return nil, nil
+}
+
+// Containers returns the running containers with the Labels
+func (wd *WebDocker) Containers(ctx context.Context) ([]Container, error) {
+	e, err := engineOf(wd.Host)
+	if err != nil {
+		return nil, err
+	}
+	return e.containers(ctx, wd.Labels)
+}
+
+// WebDockerSession draws the container picker until a container is selected,
+// then it is the TTY of the exec in the container.
+type WebDockerSession struct {
+	WebDocker
+	info   webterm.SessionInfo
+	engine *engine
+	picker *webterm.Picker
+}
+
+// SetSessionInfo implements webterm.SessionInfoSetter
+func (wds *WebDockerSession) SetSessionInfo(info webterm.SessionInfo) {
+	wds.info = info
+}
+
+func (wds *WebDockerSession) Open() error {
+	e, err := engineOf(wds.Host)
+	if err != nil {
+		return err
+	}
+	wds.engine = e
+	if wds.Container != "" {
+		return wds.pick([]string{wds.Container}, nil).Select(0)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	containers, err := e.containers(ctx, wds.Labels)
+	if err != nil {
+		return err
+	}
+	ids := make([]string, len(containers))
+	items := make([]string, len(containers))
+	for i, c := range containers {
+		ids[i] = c.ID
+		items[i] = fmt.Sprintf("%s  %s  %s", c.Name(), c.Image, c.Status)
+	}
+	if name := wds.info.Query.Get("container"); name != "" {
+		i := slices.IndexFunc(containers, func(c Container) bool { return c.match(name) })
+		if i < 0 {
+			return fmt.Errorf("webdocker has no running container %q", name)
+		}
+		return wds.pick(ids, items).Select(i)
+	}
+	if len(containers) == 0 {
+		return ErrNoContainer
+	}
+	return wds.pick(ids, items).Open()
+}
+
+// pick sets the picker of the containers
+func (wds *WebDockerSession) pick(ids []string, items []string) *webterm.Picker {
+	wds.picker = webterm.NewPicker("Containers", items, wds.info.Cols, wds.info.Rows,
+		func(i, cols, rows int) (webterm.Session, error) {
+			return wds.start(ids[i], cols, rows)
+		})
+	return wds.picker
+}
+
+// start creates the exec in the container and attaches to it
+func (wds *WebDockerSession) start(container string, cols, rows int) (*execSession, error) {
+	cmd := wds.Command
+	if len(cmd) == 0 {
+		cmd = DefaultCommand
+	}
+	cfg := execConfig{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Tty:          true,
+		Cmd:          cmd,
+		User:         wds.User,
+		WorkingDir:   wds.WorkingDir,
+		Env: append(slices.Clip(wds.Env),
+			"WEBTERM_SESSION_ID="+wds.info.ID,
+			"WEBTERM_USER="+wds.info.Principal.Name,
+		),
+	}
+	if cols > 0 {
+		cfg.ConsoleSize = &[2]uint{uint(rows), uint(cols)}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	id, err := wds.engine.execCreate(ctx, container, cfg)
+	if err != nil {
+		return nil, err
+	}
+	conn, reader, err := wds.engine.execStart(ctx, id, cfg.ConsoleSize)
+	if err != nil {
+		return nil, err
+	}
+	return &execSession{engine: wds.engine, id: id, conn: conn, reader: reader}, nil
+}
+
+func (wds *WebDockerSession) Read(p []byte) (int, error) {
+	return wds.picker.Read(p)
+}
+
+// Write sends the input to the command, or selects a container of the picker
+func (wds *WebDockerSession) Write(p []byte) (int, error) {
+	return wds.picker.Write(p)
+}
+
+// SetWinSize resizes the TTY of the exec
+func (wds *WebDockerSession) SetWinSize(cols int, rows int) error {
+	return wds.picker.SetWinSize(cols, rows)
+}
+
+func (wds *WebDockerSession) Control(data []byte) error {
+	return nil
+}
+
+// Close closes the stream of the exec
+func (wds *WebDockerSession) Close() error {
+	if wds.picker == nil {
+		return nil
+	}
+	return wds.picker.Close()
+}
+
+// execSession is the TTY of a started exec
+type execSession struct {
+	engine    *engine
+	id        string
+	conn      net.Conn
+	reader    io.Reader
+	closeOnce sync.Once
+}
+
+func (es *execSession) Open() error {
+	return nil
+}
+
+func (es *execSession) Read(p []byte) (int, error) {
+	return es.reader.Read(p)
+}
+
+func (es *execSession) Write(p []byte) (int, error) {
+	return es.conn.Write(p)
+}
+
+func (es *execSession) SetWinSize(cols int, rows int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), apiTimeout)
+	defer cancel()
+	return es.engine.execResize(ctx, es.id, cols, rows)
+}
+
+func (es *execSession) Control(data []byte) error {
+	return nil
+}
+
+func (es *execSession) Close() error {
+	es.closeOnce.Do(func() {
+		if err := es.conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Error("webdocker failed to close the exec stream", "exec", es.id, "error", err)
+		}
+	})
+	return nil
+}
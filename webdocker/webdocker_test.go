@@ -0,0 +1,254 @@
+package webdocker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm/webclient"
+	"github.com/OutOfBedlam/webterm/webtermtest"
+	"github.com/gorilla/websocket"
+)
+
+// fakeEngine is a Docker Engine API on a Unix socket, its execs echo the input
+type fakeEngine struct {
+	host       string
+	containers []Container
+
+	mu      sync.Mutex
+	execs   map[string]execConfig
+	execIn  map[string]string // container of the exec
+	resizes []string
+	conns   atomic.Int32
+	stuck   bool // the daemon does not answer the start of execs
+}
+
+func newFakeEngine(t *testing.T) *fakeEngine {
+	fe := &fakeEngine{
+		containers: []Container{
+			{ID: strings.Repeat("a", 64), Names: []string{"/web"}, Image: "nginx", Status: "Up 2 hours", Labels: map[string]string{"webterm": "yes"}},
+			{ID: strings.Repeat("b", 64), Names: []string{"/db"}, Image: "postgres", Status: "Up 3 hours", Labels: map[string]string{"webterm": "yes"}},
+			{ID: strings.Repeat("c", 64), Names: []string{"/secret"}, Image: "vault", Status: "Up 1 hour"},
+		},
+		execs:  map[string]execConfig{},
+		execIn: map[string]string{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1.41/containers/json", fe.list)
+	mux.HandleFunc("POST /v1.41/containers/{id}/exec", fe.create)
+	mux.HandleFunc("POST /v1.41/exec/{id}/start", fe.start)
+	mux.HandleFunc("POST /v1.41/exec/{id}/resize", func(w http.ResponseWriter, r *http.Request) {
+		fe.mu.Lock()
+		fe.resizes = append(fe.resizes, r.URL.Query().Get("w")+"x"+r.URL.Query().Get("h"))
+		fe.mu.Unlock()
+	})
+	sock := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(mux)
+	srv.Listener = l
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			fe.conns.Add(1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	fe.host = "unix://" + sock
+	return fe
+}
+
+func (fe *fakeEngine) list(w http.ResponseWriter, r *http.Request) {
+	var filters struct {
+		Label []string `json:"label"`
+	}
+	if f := r.URL.Query().Get("filters"); f != "" {
+		json.Unmarshal([]byte(f), &filters)
+	}
+	ret := []Container{}
+	for _, c := range fe.containers {
+		if !slices.ContainsFunc(filters.Label, func(l string) bool {
+			k, v, hasValue := strings.Cut(l, "=")
+			cv, ok := c.Labels[k]
+			return !ok || hasValue && cv != v
+		}) {
+			ret = append(ret, c)
+		}
+	}
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (fe *fakeEngine) create(w http.ResponseWriter, r *http.Request) {
+	i := slices.IndexFunc(fe.containers, func(c Container) bool { return c.match(r.PathValue("id")) })
+	if i < 0 {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"message": "No such container: %s"}`, r.PathValue("id"))
+		return
+	}
+	var cfg execConfig
+	json.NewDecoder(r.Body).Decode(&cfg)
+	fe.mu.Lock()
+	id := fmt.Sprintf("exec%d", len(fe.execs)+1)
+	fe.execs[id] = cfg
+	fe.execIn[id] = fe.containers[i].Name()
+	fe.mu.Unlock()
+	w.WriteHeader(http.StatusCreated)
+	fmt.Fprintf(w, `{"Id": %q}`, id)
+}
+
+func (fe *fakeEngine) start(w http.ResponseWriter, r *http.Request) {
+	fe.mu.Lock()
+	name, ok := fe.execIn[r.PathValue("id")]
+	fe.mu.Unlock()
+	if !ok || r.Header.Get("Upgrade") != "tcp" {
+		http.Error(w, `{"message": "bad exec"}`, http.StatusBadRequest)
+		return
+	}
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if fe.stuck {
+		io.Copy(io.Discard, conn)
+		return
+	}
+	fmt.Fprintf(buf, "HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	fmt.Fprintf(buf, "[%s]$ ", name)
+	buf.Flush()
+	io.Copy(conn, buf)
+}
+
+func (fe *fakeEngine) exec(id string) execConfig {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	return fe.execs[id]
+}
+
+func TestConformance(t *testing.T) {
+	fe := newFakeEngine(t)
+	wd := &WebDocker{Host: fe.host, Container: "web"}
+	webtermtest.TestSession(t, wd.Session)
+	webtermtest.TestRunner(t, wd)
+}
+
+func TestExec(t *testing.T) {
+	fe := newFakeEngine(t)
+	wd := &WebDocker{Host: fe.host, Container: "db", Command: []string{"psql"}, User: "postgres", Env: []string{"PAGER=less"}}
+	h := webtermtest.NewHarness(t, wd)
+	c := h.Connect(webclient.WithSize(120, 40))
+	c.ExpectOutput("[db]$ ")
+	c.Send("select 1;")
+	c.ExpectOutput("select 1;")
+	c.Resize(100, 30)
+	c.Send("sync")
+	c.ExpectOutput("sync")
+
+	cfg := fe.exec("exec1")
+	if !cfg.Tty || !cfg.AttachStdin || cfg.User != "postgres" || fmt.Sprint(cfg.Cmd) != "[psql]" {
+		t.Errorf("Unexpected exec %+v", cfg)
+	}
+	if cfg.ConsoleSize == nil || *cfg.ConsoleSize != [2]uint{40, 120} {
+		t.Errorf("Expected the console size 40x120, got %v", cfg.ConsoleSize)
+	}
+	if !slices.Contains(cfg.Env, "PAGER=less") || !slices.Contains(cfg.Env, "WEBTERM_SESSION_ID="+c.Session().ID) {
+		t.Errorf("Unexpected env %q", cfg.Env)
+	}
+	fe.mu.Lock()
+	if n := len(fe.resizes); n < 2 || fe.resizes[0] != "120x40" || fe.resizes[n-1] != "100x30" {
+		t.Errorf("Unexpected resizes %v", fe.resizes)
+	}
+	fe.mu.Unlock()
+}
+
+func TestPicker(t *testing.T) {
+	fe := newFakeEngine(t)
+	wd := &WebDocker{Host: fe.host, Labels: []string{"webterm=yes"}}
+	h := webtermtest.NewHarness(t, wd)
+	c := h.Connect()
+	out := c.ExpectOutput("Enter to start")
+	if !strings.Contains(out, "1) web  nginx  Up 2 hours") || !strings.Contains(out, "2) db") || strings.Contains(out, "secret") {
+		t.Errorf("Unexpected picker %q", out)
+	}
+	c.Send("\x1b[B")
+	c.ExpectOutput("\x1b[7m 2) db")
+	c.Send("\r")
+	c.ExpectOutput("[db]$ ")
+
+	// the query picks the container among the ones with the labels
+	c = h.ConnectQuery("container=web")
+	c.ExpectOutput("[web]$ ")
+	c = h.ConnectQuery("container=" + strings.Repeat("a", 12))
+	c.ExpectOutput("[web]$ ")
+	c = h.ConnectQuery("container=secret")
+	var ce *websocket.CloseError
+	if err := c.ExpectClosed(); !errors.As(err, &ce) || ce.Code != websocket.CloseInternalServerErr {
+		t.Errorf("Expected the container to be rejected, got %v", err)
+	}
+}
+
+func TestAPIError(t *testing.T) {
+	fe := newFakeEngine(t)
+	s, _ := (&WebDocker{Host: fe.host, Container: "missing"}).Session()
+	err := s.Open()
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "No such container: missing" {
+		t.Errorf("Expected the API error, got %v", err)
+	}
+	if _, err := newEngine("ssh://host"); err == nil {
+		t.Errorf("Expected an error for an unsupported host")
+	}
+}
+
+func TestStuckDaemon(t *testing.T) {
+	defer func(d time.Duration) { apiTimeout = d }(apiTimeout)
+	apiTimeout = 100 * time.Millisecond
+	fe := newFakeEngine(t)
+	fe.stuck = true
+	s, _ := (&WebDocker{Host: fe.host, Container: "web"}).Session()
+	start := time.Now()
+	var ne net.Error
+	if err := s.Open(); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected the handshake to time out, it took %v", d)
+	}
+	s.Close()
+}
+
+func TestEngineReuse(t *testing.T) {
+	fe := newFakeEngine(t)
+	wd := &WebDocker{Host: fe.host, Container: "web"}
+	for range 3 {
+		s, _ := wd.Session()
+		if err := s.Open(); err != nil {
+			t.Fatal(err)
+		}
+		s.Close()
+		if _, err := wd.Containers(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e1, _ := engineOf(fe.host)
+	e2, _ := engineOf(fe.host)
+	if e1 != e2 {
+		t.Errorf("Expected one engine per host")
+	}
+	// the API calls reuse the idle connection of the engine
+	if n := fe.conns.Load(); n != 3+1 {
+		t.Errorf("Expected a connection per exec and one for the API calls, got %d", n)
+	}
+}
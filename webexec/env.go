@@ -0,0 +1,80 @@
+package webexec
+
+import (
+	"os"
+	"strings"
+
+	"github.com/OutOfBedlam/webterm"
+)
+
+// DefaultInheritEnv are the variables of the server passed to the commands
+// if WebExec.InheritEnv is nil
+var DefaultInheritEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TZ", "LC_*"}
+
+const (
+	DefaultTerm      = "xterm-256color"
+	DefaultColorTerm = "truecolor"
+	DefaultLang      = "C.UTF-8" // if the server has no LANG
+)
+
+// environ returns the environment of the command of the session, later variables win:
+// the inherited ones, TERM, COLORTERM and LANG, HOME of the workspace, Env, and the variables of the session.
+func (wes *WebExecSession) environ() []string {
+	inherit := wes.InheritEnv
+	if inherit == nil {
+		inherit = DefaultInheritEnv
+	}
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if matchEnv(inherit, name) {
+			env = append(env, kv)
+		}
+	}
+	env = append(env,
+		"TERM="+orDefault(wes.Term, DefaultTerm),
+		"COLORTERM="+orDefault(wes.ColorTerm, DefaultColorTerm),
+		"LANG="+orDefault(wes.Lang, orDefault(os.Getenv("LANG"), DefaultLang)),
+	)
+	if wes.workspace != "" && wes.Workspace.Home {
+		env = append(env, "HOME="+wes.workspace)
+	}
+	env = append(env, wes.Env...)
+	if wes.info.ID != "" {
+		env = append(env,
+			"WEBTERM_SESSION_ID="+wes.info.ID,
+			"WEBTERM_USER="+wes.info.Principal.Name,
+			"WEBTERM_ROLES="+strings.Join(wes.info.Principal.Roles, ","),
+		)
+	}
+	if wes.SessionEnv != nil {
+		env = append(env, wes.SessionEnv(wes.info)...)
+	}
+	return env
+}
+
+// matchEnv reports whether name is in the list, an entry ending with "*" matches a prefix
+func matchEnv(list []string, name string) bool {
+	for _, pattern := range list {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// SetSessionInfo implements webterm.SessionInfoSetter
+func (wes *WebExecSession) SetSessionInfo(info webterm.SessionInfo) {
+	wes.info = info
+}
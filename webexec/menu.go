@@ -0,0 +1,126 @@
+package webexec
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"slices"
+
+	"github.com/OutOfBedlam/webterm"
+)
+
+var _ webterm.Runner = (*Menu)(nil)
+var _ webterm.Session = (*MenuSession)(nil)
+var _ webterm.SessionInfoSetter = (*MenuSession)(nil)
+
+// Menu is a Runner offering several commands on one endpoint.
+// The page picks one with the "command" query, e.g. "/tools/?command=psql",
+// otherwise the user selects it from a menu drawn in the terminal.
+type Menu struct {
+	Title   string // heading of the menu
+	Entries []MenuEntry
+}
+
+// MenuEntry is a command of a Menu, it runs as its WebExec
+type MenuEntry struct {
+	Name        string // identifies the entry in the "command" query
+	Label       string // shown in the menu, Name if empty
+	Description string
+	// Roles limits the entry to principals with one of the roles, everyone if empty
+	Roles []string
+	WebExec
+}
+
+func (e MenuEntry) allowed(p webterm.Principal) bool {
+	return len(e.Roles) == 0 || slices.ContainsFunc(e.Roles, p.HasRole)
+}
+
+var ErrNoCommand = errors.New("webexec menu has no command for the user")
+
+func (m *Menu) Session() (webterm.Session, error) {
+	return &MenuSession{Menu: *m}, nil
+}
+
+func (m *Menu) Template() (*template.Template, any) {
+	return nil, nil
+}
+
+// MenuSession draws the menu until an entry is selected, then it is the session of the entry.
+type MenuSession struct {
+	Menu
+	info    webterm.SessionInfo
+	entries []MenuEntry // the entries the principal may run
+	picker  *webterm.Picker
+}
+
+// SetSessionInfo implements webterm.SessionInfoSetter
+func (ms *MenuSession) SetSessionInfo(info webterm.SessionInfo) {
+	ms.info = info
+}
+
+func (ms *MenuSession) Open() error {
+	var items []string
+	for _, e := range ms.Entries {
+		if !e.allowed(ms.info.Principal) {
+			continue
+		}
+		ms.entries = append(ms.entries, e)
+		item := e.Label
+		if item == "" {
+			item = e.Name
+		}
+		if e.Description != "" {
+			item += "  " + e.Description
+		}
+		items = append(items, item)
+	}
+	ms.picker = webterm.NewPicker(ms.Title, items, ms.info.Cols, ms.info.Rows, ms.start)
+	if name := ms.info.Query.Get("command"); name != "" {
+		i := slices.IndexFunc(ms.entries, func(e MenuEntry) bool { return e.Name == name })
+		if i < 0 {
+			return fmt.Errorf("webexec menu has no command %q for the user", name)
+		}
+		return ms.picker.Select(i)
+	}
+	if len(ms.entries) == 0 {
+		return ErrNoCommand
+	}
+	return ms.picker.Open()
+}
+
+// start runs the entry i with the window size
+func (ms *MenuSession) start(i, cols, rows int) (webterm.Session, error) {
+	info := ms.info
+	info.Cols, info.Rows = cols, rows
+	wes := &WebExecSession{WebExec: ms.entries[i].WebExec}
+	wes.SetSessionInfo(info)
+	if err := wes.Open(); err != nil {
+		return nil, err
+	}
+	return wes, nil
+}
+
+func (ms *MenuSession) Read(p []byte) (int, error) {
+	return ms.picker.Read(p)
+}
+
+// Write sends the input to the command, or selects an entry of the menu
+func (ms *MenuSession) Write(p []byte) (int, error) {
+	return ms.picker.Write(p)
+}
+
+func (ms *MenuSession) SetWinSize(cols int, rows int) error {
+	return ms.picker.SetWinSize(cols, rows)
+}
+
+// Control is passed to the command, see ControlMessage
+func (ms *MenuSession) Control(data []byte) error {
+	return ms.picker.Control(data)
+}
+
+func (ms *MenuSession) Close() error {
+	if ms.picker == nil {
+		return nil
+	}
+	return ms.picker.Close()
+}
@@ -0,0 +1,78 @@
+package webexec
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/OutOfBedlam/webterm/webtermtest"
+	"github.com/gorilla/websocket"
+)
+
+func testMenu() *Menu {
+	return &Menu{
+		Title: "Tools",
+		Entries: []MenuEntry{
+			{Name: "hello", Description: "says hello", WebExec: WebExec{Command: "sh", Args: []string{"-c", "echo hello $WHO; read line"}, Env: []string{"WHO=world"}}},
+			{Name: "pwd", WebExec: WebExec{Command: "sh", Args: []string{"-c", "pwd; read line"}, Dir: "/"}},
+			{Name: "admin", Label: "Admin shell", Roles: []string{"admin"}, WebExec: WebExec{Command: "sh"}},
+		},
+	}
+}
+
+func TestMenuConformance(t *testing.T) {
+	webtermtest.TestSession(t, testMenu().Session)
+	webtermtest.TestRunner(t, testMenu())
+}
+
+func TestMenuSelect(t *testing.T) {
+	h := webtermtest.NewHarness(t, testMenu())
+	c := h.Connect()
+	out := c.ExpectOutput("Enter to start")
+	for _, s := range []string{"Tools", "1) hello  says hello", "2) pwd"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected %q in the menu %q", s, out)
+		}
+	}
+	if strings.Contains(out, "Admin") {
+		t.Errorf("Unexpected entry for the role admin in %q", out)
+	}
+	// down and back up, then the second entry by number
+	c.Send("\x1b[B")
+	c.ExpectOutput("\x1b[7m 2) pwd")
+	c.Send("\x1b[A")
+	c.ExpectOutput("\x1b[7m 1) hello")
+	c.Send("2\r")
+	c.ExpectOutput("\x1b[2J/\r\n")
+	c.Send("\r")
+	if err := c.ExpectClosed(); err != nil {
+		t.Errorf("Expected the session to end with the command, got %v", err)
+	}
+}
+
+func TestMenuQuery(t *testing.T) {
+	h := webtermtest.NewHarness(t, testMenu(), webterm.WithAuthenticator(func(r *http.Request) (webterm.Principal, error) {
+		return webterm.Principal{Name: "alice", Roles: []string{"dev"}}, nil
+	}))
+	c := h.ConnectQuery("command=hello")
+	c.ExpectOutput("hello world")
+
+	// the entry requires a role alice does not have
+	c = h.ConnectQuery("command=admin")
+	var ce *websocket.CloseError
+	if err := c.ExpectClosed(); !errors.As(err, &ce) || ce.Code != websocket.CloseInternalServerErr {
+		t.Errorf("Expected the session to be rejected, got %v", err)
+	}
+}
+
+func TestMenuQuit(t *testing.T) {
+	h := webtermtest.NewHarness(t, testMenu())
+	c := h.Connect()
+	c.ExpectOutput("Enter to start")
+	c.Send("q")
+	if err := c.ExpectClosed(); err != nil {
+		t.Errorf("Expected the session to end, got %v", err)
+	}
+}
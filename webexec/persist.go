@@ -0,0 +1,232 @@
+package webexec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+)
+
+// Persist runs the commands of the sessions in tmux or screen sessions of the user,
+// which keep running when the connection or the server ends.
+// The sessions belong to the principal, anonymous users are rejected.
+// It can not be used with a Sandbox in a PID namespace.
+// The page picks the session with the "persist" query, e.g. "?persist=build",
+// DefaultPersistName if not given. The session is created by the first connection
+// and attached to again by the later ones.
+//
+// Every user has a tmux or screen server of their own, "<prefix>-<user>", so the sessions
+// of the other users can not be listed or attached to with tmux or screen.
+// The servers run as the system user of the commands though, a shell can still connect
+// to the socket of another user by its path if the users share the system user.
+//
+// The tmux or screen server must outlive the webterm process, e.g. with KillMode=process
+// of systemd, otherwise it is stopped together with the server.
+type Persist struct {
+	Tool string `json:"tool,omitempty"` // "tmux" or "screen", "tmux" if empty
+	// SocketDir is the directory of the sockets of the servers, created with mode 0700.
+	// If empty tmux servers are "tmux -L <prefix>-<user>" and screen servers have the
+	// SCREENDIR "<temp dir>/webterm-screen/<prefix>-<user>".
+	SocketDir string `json:"socketDir,omitempty"`
+	Prefix    string `json:"prefix,omitempty"` // prefix of the server names, "webterm" if empty
+}
+
+const DefaultPersistName = "main"
+
+var ErrNoPersistUser = errors.New("webexec persist requires an authenticated user")
+
+// PersistSession is a persistent session of a user
+type PersistSession struct {
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created,omitzero"` // zero for screen
+	Attached bool      `json:"attached"`
+}
+
+func (p *Persist) tool() string {
+	return orDefault(p.Tool, "tmux")
+}
+
+// server is the name of the tmux or screen server of the user, "<prefix>-<user>" with the user escaped
+func (p *Persist) server(user string) string {
+	return orDefault(p.Prefix, "webterm") + "-" + escapeName(user)
+}
+
+// tmuxArgs selects the tmux server of the user
+func (p *Persist) tmuxArgs(user string) []string {
+	if p.SocketDir == "" {
+		return []string{"-L", p.server(user)}
+	}
+	return []string{"-S", filepath.Join(p.SocketDir, p.server(user))}
+}
+
+// screenDir is the SCREENDIR of the screen server of the user
+func (p *Persist) screenDir(user string) string {
+	dir := p.SocketDir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "webterm-screen")
+	}
+	return filepath.Join(dir, p.server(user))
+}
+
+// command returns the program, the arguments and the environment creating or attaching the session
+// name of the user, the command is started only when the session is created.
+func (p *Persist) command(user, name, dir, command string, args, env []string) (string, []string, []string, error) {
+	var ret []string
+	switch p.tool() {
+	case "screen":
+		sdir := p.screenDir(user)
+		// screen requires a directory of mode 0700
+		if err := os.MkdirAll(sdir, 0700); err != nil {
+			return "", nil, nil, err
+		}
+		env = append(env, "SCREENDIR="+sdir)
+		ret = []string{"-xRR", "-S", escapeName(name)}
+	default:
+		if p.SocketDir != "" {
+			if err := os.MkdirAll(p.SocketDir, 0700); err != nil {
+				return "", nil, nil, err
+			}
+		}
+		ret = append(p.tmuxArgs(user), "new-session", "-A", "-s", escapeName(name))
+		if dir != "" {
+			ret = append(ret, "-c", dir)
+		}
+	}
+	if command != "" {
+		ret = append(ret, command)
+		ret = append(ret, args...)
+	}
+	return p.tool(), ret, env, nil
+}
+
+// Sessions returns the persistent sessions of the user, none if the tmux or screen server is not running
+func (p *Persist) Sessions(user string) ([]PersistSession, error) {
+	var ret []PersistSession
+	switch p.tool() {
+	case "screen":
+		sdir := p.screenDir(user)
+		if _, err := os.Stat(sdir); errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		// screen -ls exits with 1 when there are sessions, the output tells
+		cmd := exec.Command("screen", "-ls")
+		cmd.Env = append(os.Environ(), "SCREENDIR="+sdir)
+		out, _ := cmd.Output()
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			// "	12345.main	(10/18/2026 09:00:00 AM)	(Detached)"
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || !strings.HasPrefix(fields[len(fields)-1], "(") {
+				continue
+			}
+			_, session, ok := strings.Cut(fields[0], ".")
+			if !ok {
+				continue
+			}
+			state := strings.ToLower(fields[len(fields)-1])
+			ret = append(ret, PersistSession{
+				Name:     unescapeName(session),
+				Attached: strings.HasSuffix(state, "attached)"),
+			})
+		}
+	default:
+		args := append(p.tmuxArgs(user), "list-sessions", "-F", "#{session_name}\t#{session_created}\t#{session_attached}")
+		out, err := exec.Command("tmux", args...).Output()
+		if err != nil {
+			var ee *exec.ExitError
+			if errors.As(err, &ee) && noTmuxServer(ee.Stderr) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(out))
+		for scanner.Scan() {
+			fields := strings.Split(scanner.Text(), "\t")
+			if len(fields) != 3 {
+				continue
+			}
+			created, _ := strconv.ParseInt(fields[1], 10, 64)
+			attached, _ := strconv.Atoi(fields[2])
+			ret = append(ret, PersistSession{
+				Name:     unescapeName(fields[0]),
+				Created:  time.Unix(created, 0),
+				Attached: attached > 0,
+			})
+		}
+	}
+	return ret, nil
+}
+
+func noTmuxServer(stderr []byte) bool {
+	s := string(stderr)
+	return strings.Contains(s, "no server running") || strings.Contains(s, "error connecting to")
+}
+
+// Handler returns the HTTP handler listing the persistent sessions of the principal as JSON,
+// the page attaches to one of them with "?persist=<name>".
+// auth resolves the principal like the one of the WebTerm, nil if there is no authentication.
+func (p *Persist) Handler(auth webterm.Authenticator) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var principal webterm.Principal
+		if auth != nil {
+			var err error
+			if principal, err = auth(r); err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		sessions, err := p.Sessions(principal.Name)
+		if err != nil {
+			slog.Error("webexec failed to list persistent sessions", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if sessions == nil {
+			sessions = []PersistSession{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sessions)
+	})
+}
+
+// escapeName keeps letters and digits, the other bytes are "_xx" in hex.
+// tmux does not allow "." and ":" in session names, and "-" separates the parts.
+func escapeName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+func unescapeName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '_' && i+2 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 2
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,129 @@
+//go:build !windows
+
+package webexec
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/OutOfBedlam/webterm/webtermtest"
+)
+
+func TestEscapeName(t *testing.T) {
+	for _, s := range []string{"alice", "alice-x", "alice_x", "a.b:c", "", "홍길동"} {
+		e := escapeName(s)
+		if got := unescapeName(e); got != s {
+			t.Errorf("unescapeName(%q) = %q, expected %q", e, got, s)
+		}
+	}
+	if escapeName("alice-x") == escapeName("alice_x") {
+		t.Errorf("Expected different names for alice-x and alice_x")
+	}
+}
+
+func TestPersist(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux is not installed")
+	}
+	// the servers of the test, kill-server returns before it is gone
+	p := &Persist{SocketDir: t.TempDir()}
+	socket := filepath.Join(p.SocketDir, "webterm-alice")
+	t.Cleanup(func() {
+		out, err := exec.Command("tmux", "-S", socket, "display-message", "-p", "#{pid}").Output()
+		if err != nil {
+			return // no server
+		}
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(out)))
+		exec.Command("tmux", "-S", socket, "kill-server").Run()
+		for i := 0; i < 100 && alive(pid); i++ {
+			time.Sleep(20 * time.Millisecond)
+		}
+	})
+	auth := func(r *http.Request) (webterm.Principal, error) {
+		return webterm.Principal{Name: "alice"}, nil
+	}
+	we := &WebExec{Command: "sh", Persist: p}
+	h := webtermtest.NewHarness(t, we, webterm.WithAuthenticator(auth))
+
+	c := h.ConnectQuery("persist=work")
+	c.Send("X=kept; echo $((40+2))\r")
+	c.ExpectOutput("42")
+	waitPersist(t, p, "alice", true)
+	c.Close()
+	h.ExpectSessions(0)
+
+	sessions := waitPersist(t, p, "alice", false)
+	if sessions[0].Name != "work" {
+		t.Fatalf("Expected the session work, got %+v", sessions)
+	}
+	if other, err := p.Sessions("bob"); err != nil || len(other) != 0 {
+		t.Errorf("Expected no sessions of bob, got %+v %v", other, err)
+	}
+
+	// the shell kept running and its variable
+	c = h.ConnectQuery("persist=work")
+	c.Send("echo X=$X\r")
+	c.ExpectOutput("X=kept")
+
+	rec := httptest.NewRecorder()
+	p.Handler(auth).ServeHTTP(rec, httptest.NewRequest("GET", "/persist", nil))
+	var listed []PersistSession
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil || len(listed) != 1 || !listed[0].Attached {
+		t.Errorf("Expected the attached session work, got %s %v", rec.Body, err)
+	}
+}
+
+// waitPersist waits until the user has one session in the state
+func waitPersist(t *testing.T, p *Persist, user string, attached bool) []PersistSession {
+	t.Helper()
+	var sessions []PersistSession
+	var err error
+	for i := 0; i < 100; i++ {
+		sessions, err = p.Sessions(user)
+		if err == nil && len(sessions) == 1 && sessions[0].Attached == attached {
+			return sessions
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("Expected a session with attached=%v, got %+v %v", attached, sessions, err)
+	return nil
+}
+
+func TestPersistServers(t *testing.T) {
+	p := &Persist{}
+	_, alice, _, _ := p.command("alice", "main", "", "sh", nil, nil)
+	_, bob, _, _ := p.command("bob", "main", "", "sh", nil, nil)
+	if strings.Join(alice, " ") != "-L webterm-alice new-session -A -s main sh" || strings.Join(bob[:2], " ") != "-L webterm-bob" {
+		t.Errorf("Expected a tmux server per user, got %q and %q", alice, bob)
+	}
+
+	p = &Persist{Tool: "screen", SocketDir: t.TempDir()}
+	_, args, env, err := p.command("alice", "main", "", "sh", nil, nil)
+	dir := filepath.Join(p.SocketDir, "webterm-alice")
+	if err != nil || strings.Join(args, " ") != "-xRR -S main sh" || !slices.Contains(env, "SCREENDIR="+dir) {
+		t.Errorf("Expected the screen directory of the user, got %q %q %v", args, env, err)
+	}
+	if fi, err := os.Stat(dir); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("Expected the screen directory with mode 0700, got %v", err)
+	}
+}
+
+func TestPersistAnonymous(t *testing.T) {
+	we := &WebExec{Command: "sh", Persist: &Persist{}}
+	s, _ := we.Session()
+	if err := s.Open(); !errors.Is(err, ErrNoPersistUser) {
+		s.Close()
+		t.Errorf("Expected ErrNoPersistUser, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package webexec
+
+import "errors"
+
+// Sandbox restricts the command of a WebExec, e.g. for a public demo shell.
+// It is supported on Linux only and most options require the server to run as root.
+//
+// The credential and the namespaces alone are set when the command is started.
+// Mounts, the hostname and rlimits are set up in the new process before the command runs,
+// it is started through the server binary then, see the package documentation.
+type Sandbox struct {
+	// Credential runs the command as another user, e.g. nobody
+	Credential *Credential `json:"credential,omitempty"`
+	Namespaces Namespaces  `json:"namespaces,omitzero"`
+	Rlimits    Rlimits     `json:"rlimits,omitzero"`
+	// ReadOnlyRoot makes all file systems read-only, except the writable Binds
+	ReadOnlyRoot bool `json:"readOnlyRoot,omitempty"`
+	// Hide covers the directories with an empty read-only file system, e.g. the workspaces
+	// of the other users. The Binds are mounted after it, also into the hidden directories.
+	Hide  []string `json:"hide,omitempty"`
+	Binds []Bind   `json:"binds,omitempty"`
+}
+
+type Credential struct {
+	UID    uint32   `json:"uid"`
+	GID    uint32   `json:"gid"`
+	Groups []uint32 `json:"groups,omitempty"` // supplementary groups, none if empty
+}
+
+// Namespaces of the command. A new mount namespace is also created
+// for ReadOnlyRoot, Hide, Binds and the PID namespace, which remounts /proc.
+type Namespaces struct {
+	PID      bool   `json:"pid,omitempty"` // the command sees only its own processes and the init of the sandbox
+	Mount    bool   `json:"mount,omitempty"`
+	Net      bool   `json:"net,omitempty"` // no network, only a loopback device which is down
+	UTS      bool   `json:"uts,omitempty"`
+	Hostname string `json:"hostname,omitempty"` // hostname in the new UTS namespace
+}
+
+// Rlimits of the command, zero leaves a limit as it is
+type Rlimits struct {
+	CPU uint64 `json:"cpu,omitempty"` // seconds of CPU time
+	// Memory is the size of the address space in bytes
+	Memory uint64 `json:"memory,omitempty"`
+	// Processes is the number of processes of the user, it counts all processes
+	// of the uid, not only the ones of the session, so use it with a Credential.
+	Processes uint64 `json:"processes,omitempty"`
+	OpenFiles uint64 `json:"openFiles,omitempty"`
+	FileSize  uint64 `json:"fileSize,omitempty"` // the largest file the command can write in bytes
+}
+
+// Bind mounts Source on Target in the sandbox, read-only unless Writable
+type Bind struct {
+	Source   string `json:"source"`
+	Target   string `json:"target,omitempty"` // Source if empty
+	Writable bool   `json:"writable,omitempty"`
+}
+
+var ErrSandboxUnsupported = errors.New("webexec sandbox is supported on Linux only")
+
+func (sb *Sandbox) newMountNS() bool {
+	return sb.Namespaces.Mount || sb.Namespaces.PID || sb.ReadOnlyRoot || len(sb.Hide) > 0 || len(sb.Binds) > 0
+}
@@ -0,0 +1,354 @@
+//go:build linux
+
+package webexec
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	sandboxArg0 = "webexec-sandbox"
+	sandboxEnv  = "WEBEXEC_SANDBOX"
+)
+
+// init runs the sandbox setup when the binary is started by Sandbox.command,
+// before the main function of the server, see the package documentation.
+func init() {
+	if len(os.Args) > 2 && os.Args[0] == sandboxArg0 && os.Getenv(sandboxEnv) != "" {
+		err := runSandbox()
+		// the pty is in raw mode, the user sees the error in the terminal
+		fmt.Fprintf(os.Stderr, "webexec sandbox: %v\r\n", err)
+		os.Exit(127)
+	}
+}
+
+// command returns the command in new namespaces, env is the environment of the command.
+// It is started through the server binary if the sandbox has to be set up in the new process.
+func (sb *Sandbox) command(name string, args []string, env []string) (*exec.Cmd, error) {
+	var flags uintptr
+	if sb.newMountNS() {
+		flags |= syscall.CLONE_NEWNS
+	}
+	if sb.Namespaces.PID {
+		flags |= syscall.CLONE_NEWPID
+	}
+	if sb.Namespaces.Net {
+		flags |= syscall.CLONE_NEWNET
+	}
+	if sb.Namespaces.UTS {
+		flags |= syscall.CLONE_NEWUTS
+	}
+	if !sb.needsSetup() {
+		cmd := exec.Command(name, args...)
+		cmd.Env = env
+		cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: flags, Credential: sb.Credential.sys()}
+		return cmd, nil
+	}
+	// looked up like exec.Command does, with the PATH of the server
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := json.Marshal(sb)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("/proc/self/exe")
+	cmd.Args = append([]string{sandboxArg0, path, name}, args...)
+	cmd.Env = append(env, sandboxEnv+"="+string(cfg))
+	// the credential is set after the mounts by runSandbox
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: flags}
+	return cmd, nil
+}
+
+// needsSetup reports whether the sandbox is set up in the new process by runSandbox,
+// the credential and namespaces alone are set by os/exec.
+func (sb *Sandbox) needsSetup() bool {
+	return sb.newMountNS() || sb.Namespaces.UTS && sb.Namespaces.Hostname != "" || sb.Rlimits != (Rlimits{})
+}
+
+func (c *Credential) sys() *syscall.Credential {
+	if c == nil {
+		return nil
+	}
+	return &syscall.Credential{Uid: c.UID, Gid: c.GID, Groups: c.Groups}
+}
+
+// runSandbox sets up the sandbox in the new process and executes the command,
+// it returns only on errors.
+func runSandbox() error {
+	var sb Sandbox
+	if err := json.Unmarshal([]byte(os.Getenv(sandboxEnv)), &sb); err != nil {
+		return err
+	}
+	os.Unsetenv(sandboxEnv)
+	if sb.newMountNS() {
+		if err := sb.mount(); err != nil {
+			return err
+		}
+	}
+	if sb.Namespaces.UTS && sb.Namespaces.Hostname != "" {
+		if err := syscall.Sethostname([]byte(sb.Namespaces.Hostname)); err != nil {
+			return fmt.Errorf("hostname: %w", err)
+		}
+	}
+	if err := sb.Rlimits.apply(); err != nil {
+		return err
+	}
+	if sb.Namespaces.PID {
+		return runInit(sb.Credential)
+	}
+	if c := sb.Credential; c != nil {
+		groups := make([]int, len(c.Groups))
+		for i, g := range c.Groups {
+			groups[i] = int(g)
+		}
+		if err := syscall.Setgroups(groups); err != nil {
+			return fmt.Errorf("setgroups: %w", err)
+		}
+		if err := syscall.Setgid(int(c.GID)); err != nil {
+			return fmt.Errorf("setgid: %w", err)
+		}
+		if err := syscall.Setuid(int(c.UID)); err != nil {
+			return fmt.Errorf("setuid: %w", err)
+		}
+	}
+	return syscall.Exec(os.Args[1], os.Args[2:], os.Environ())
+}
+
+// runInit runs the command as the child of the sandbox, which is PID 1 of the namespace.
+// The kernel drops the signals of the server to a PID 1 without handlers, the init
+// forwards them to every process of the namespace instead, and it reaps the orphans.
+// It exits with the status of the command, the other processes are killed then.
+func runInit(cred *Credential) error {
+	sigs := make(chan os.Signal, 8)
+	signal.Notify(sigs, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGCHLD)
+	cmd := exec.Command(os.Args[1])
+	cmd.Args = os.Args[2:]
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// the foreground process group, the keys of the terminal do not signal the init
+	cmd.SysProcAttr = &syscall.SysProcAttr{Foreground: true, Ctty: 0, Credential: cred.sys()}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	pid := cmd.Process.Pid
+	for sig := range sigs {
+		if sig != syscall.SIGCHLD {
+			syscall.Kill(-1, sig.(syscall.Signal)) // all processes but the init
+			continue
+		}
+		for {
+			var ws syscall.WaitStatus
+			wpid, err := syscall.Wait4(-1, &ws, syscall.WNOHANG, nil)
+			if err != nil || wpid <= 0 {
+				break
+			}
+			if wpid == pid {
+				if ws.Signaled() {
+					os.Exit(128 + int(ws.Signal()))
+				}
+				os.Exit(ws.ExitStatus())
+			}
+		}
+	}
+	return nil
+}
+
+func (sb *Sandbox) mount() error {
+	// keep the mounts below out of the namespace of the server
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("private mounts: %w", err)
+	}
+	if sb.ReadOnlyRoot {
+		if err := remountReadOnly(); err != nil {
+			return err
+		}
+	}
+	// the sources are opened before Hide covers them, e.g. a workspace in its Root
+	sources := make([]int, len(sb.Binds))
+	for i, b := range sb.Binds {
+		fd, err := unix.Open(b.Source, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("bind %s: %w", b.Source, err)
+		}
+		defer unix.Close(fd)
+		sources[i] = fd
+	}
+	const hideFlags = unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC
+	for _, h := range sb.Hide {
+		if err := unix.Mount("tmpfs", h, "tmpfs", hideFlags, "mode=755"); err != nil {
+			return fmt.Errorf("hide %s: %w", h, err)
+		}
+	}
+	for i, b := range sb.Binds {
+		target := b.Target
+		if target == "" {
+			target = b.Source
+		}
+		if err := bindTarget(sources[i], target); err != nil {
+			return fmt.Errorf("bind %s: %w", b.Source, err)
+		}
+		source := "/proc/self/fd/" + strconv.Itoa(sources[i])
+		if err := unix.Mount(source, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind %s: %w", b.Source, err)
+		}
+		// the bind has the flags of the source, which is read-only with ReadOnlyRoot
+		flags, err := mountFlags(target)
+		if err != nil {
+			return fmt.Errorf("bind %s: %w", b.Source, err)
+		}
+		flags &^= unix.MS_RDONLY
+		if !b.Writable {
+			flags |= unix.MS_RDONLY
+		}
+		if err := unix.Mount("", target, "", unix.MS_BIND|unix.MS_REMOUNT|flags, ""); err != nil {
+			return fmt.Errorf("bind %s: %w", b.Source, err)
+		}
+	}
+	// the targets of the binds are created in the hidden directories before they are read-only
+	for _, h := range sb.Hide {
+		if err := unix.Mount("", h, "", unix.MS_REMOUNT|unix.MS_RDONLY|hideFlags, ""); err != nil {
+			return fmt.Errorf("hide %s: %w", h, err)
+		}
+	}
+	if sb.Namespaces.PID {
+		if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+			return fmt.Errorf("mount /proc: %w", err)
+		}
+	}
+	// the working directory is looked up again, it may be covered by Hide and a bind
+	if wd, err := os.Getwd(); err == nil {
+		if err := os.Chdir(wd); err != nil {
+			return fmt.Errorf("working directory: %w", err)
+		}
+	}
+	return nil
+}
+
+// bindTarget creates the missing target of the bind of fd, e.g. in a hidden directory
+func bindTarget(fd int, target string) error {
+	if _, err := os.Lstat(target); !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	var st unix.Stat_t
+	if err := unix.Fstat(fd, &st); err != nil {
+		return err
+	}
+	if st.Mode&unix.S_IFMT == unix.S_IFDIR {
+		return os.MkdirAll(target, 0o755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// remountReadOnly remounts every mount point read-only with the flags it has, e.g. nosuid
+func remountReadOnly() error {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var mountPoints []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(s.Text())
+		if len(fields) > 4 {
+			mountPoints = append(mountPoints, unescapeMountPoint(fields[4]))
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	for _, mp := range mountPoints {
+		flags, err := mountFlags(mp)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue // hidden by another mount, it can not be reached
+		} else if err != nil {
+			return fmt.Errorf("read-only %s: %w", mp, err)
+		}
+		if flags&unix.MS_RDONLY != 0 {
+			continue
+		}
+		if err := unix.Mount("", mp, "", unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY|flags, ""); err != nil {
+			return fmt.Errorf("read-only %s: %w", mp, err)
+		}
+	}
+	return nil
+}
+
+// mountFlags returns the flags of the mount of path to keep on a remount,
+// which replaces them otherwise, e.g. it would clear nosuid and noexec.
+func mountFlags(path string) (uintptr, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	// the ST_ flags of statfs have the values of the MS_ flags
+	const keep = unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC |
+		unix.MS_NOATIME | unix.MS_NODIRATIME | unix.MS_RELATIME
+	return uintptr(st.Flags) & keep, nil
+}
+
+// unescapeMountPoint decodes the octal escapes of mountinfo, e.g. "\040" for a space
+func unescapeMountPoint(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+func (rl Rlimits) apply() error {
+	limits := []struct {
+		resource int
+		value    uint64
+		name     string
+	}{
+		{unix.RLIMIT_CPU, rl.CPU, "cpu"},
+		{unix.RLIMIT_AS, rl.Memory, "memory"},
+		{unix.RLIMIT_NPROC, rl.Processes, "processes"},
+		{unix.RLIMIT_NOFILE, rl.OpenFiles, "open files"},
+		{unix.RLIMIT_FSIZE, rl.FileSize, "file size"},
+	}
+	var errs []error
+	for _, l := range limits {
+		if l.value == 0 {
+			continue
+		}
+		lim := unix.Rlimit{Cur: l.value, Max: l.value}
+		if err := unix.Setrlimit(l.resource, &lim); err != nil {
+			errs = append(errs, fmt.Errorf("rlimit %s: %w", l.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,152 @@
+package webexec_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/OutOfBedlam/webterm/webexec"
+	"github.com/OutOfBedlam/webterm/webexpect"
+	"golang.org/x/sys/unix"
+)
+
+func requireSandbox(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("the sandbox requires root")
+	}
+	if err := exec.Command("unshare", "-pmnu", "--fork", "true").Run(); err != nil {
+		t.Skip("namespaces are not available:", err)
+	}
+}
+
+func TestSandbox(t *testing.T) {
+	requireSandbox(t)
+	dir := t.TempDir()
+	os.Chmod(dir, 0o777)
+	noexec := t.TempDir()
+	if err := unix.Mount("tmpfs", noexec, "tmpfs", unix.MS_NOSUID|unix.MS_NOEXEC, ""); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { unix.Unmount(noexec, 0) })
+
+	tests := []struct {
+		name    string
+		sandbox webexec.Sandbox
+		script  string
+		expect  string
+	}{
+		{
+			name:    "credential",
+			sandbox: webexec.Sandbox{Credential: &webexec.Credential{UID: 65534, GID: 65534}},
+			script:  "echo id=$(id -u):$(id -g)",
+			expect:  "id=65534:65534",
+		},
+		{
+			name:    "namespaces",
+			sandbox: webexec.Sandbox{Namespaces: webexec.Namespaces{PID: true, Net: true, UTS: true, Hostname: "sandbox"}},
+			script:  "echo init=$(head -c 15 /proc/1/cmdline) host=$(hostname) net=$(tail -n +3 /proc/net/dev | cut -d: -f1 | tr -d ' ')",
+			expect:  "init=webexec-sandbox host=sandbox net=lo",
+		},
+		{
+			name:    "rlimits",
+			sandbox: webexec.Sandbox{Rlimits: webexec.Rlimits{OpenFiles: 64, CPU: 10}},
+			script:  "echo files=$(ulimit -n) cpu=$(ulimit -t)",
+			expect:  "files=64 cpu=10",
+		},
+		{
+			name: "read-only root",
+			sandbox: webexec.Sandbox{ReadOnlyRoot: true, Binds: []webexec.Bind{
+				{Source: dir, Writable: true},
+			}},
+			script: "touch /sandbox-test 2>/dev/null || echo root=ro; touch " + filepath.Join(dir, "ok") + " && echo bind=rw",
+			expect: "root=ro\r\nbind=rw",
+		},
+		{
+			name:    "read-only mount flags",
+			sandbox: webexec.Sandbox{ReadOnlyRoot: true},
+			script:  `awk '$5 == "` + noexec + `" { print "opts=" $6 }' /proc/self/mountinfo`,
+			expect:  "opts=ro,nosuid,noexec,relatime",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := webexpect.Spawn(&webexec.WebExec{Command: "sh", Sandbox: &tt.sandbox},
+				webexpect.WithTimeout(5*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer e.Close()
+			e.SendLine(tt.script)
+			// at the start of a line, not in the echo of the input,
+			// after the prompt if the input was echoed before it
+			if _, err := e.Expect(`\n([$#] )?` + regexp.QuoteMeta(tt.expect)); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	if _, err := os.Stat("/sandbox-test"); err == nil {
+		os.Remove("/sandbox-test")
+		t.Errorf("Expected the root to be read-only")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ok")); err != nil {
+		t.Errorf("Expected the writable bind to be written, %v", err)
+	}
+}
+
+func TestSandboxClose(t *testing.T) {
+	requireSandbox(t)
+	dir := t.TempDir()
+	script := `trap 'echo hup > ` + dir + `/hup; exit 0' HUP; echo ready; while :; do sleep 0.1; done`
+	e, err := webexpect.Spawn(&webexec.WebExec{Command: "sh", Args: []string{"-c", script},
+		Sandbox: &webexec.Sandbox{Namespaces: webexec.Namespaces{PID: true}}},
+		webexpect.WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Expect("ready"); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	e.Close()
+	if d := time.Since(start); d > webexec.DefaultGracePeriod {
+		t.Errorf("Expected the command to exit on SIGHUP, took %s", d)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "hup")); err != nil || string(b) != "hup\n" {
+		t.Errorf("Expected the HUP trap to run, got %q %v", b, err)
+	}
+}
+
+func TestSandboxWorkspace(t *testing.T) {
+	requireSandbox(t)
+	root := t.TempDir()
+	os.Chmod(filepath.Dir(root), 0o755) // nobody looks up the root
+	os.Mkdir(filepath.Join(root, "alice"), 0o700)
+	we := &webexec.WebExec{Command: "sh", Workspace: &webexec.Workspace{Root: root},
+		Sandbox: &webexec.Sandbox{ReadOnlyRoot: true, Credential: &webexec.Credential{UID: 65534, GID: 65534}}}
+	s, _ := we.Session()
+	s.(webterm.SessionInfoSetter).SetSessionInfo(webterm.SessionInfo{Principal: webterm.Principal{Name: "bob"}})
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	e, err := webexpect.New(s, webexpect.WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	e.SendLine("echo ls=$(ls -A " + root + ") pwd=$(pwd); touch notes && echo ws=rw")
+	if _, err := e.Expect(`\n([$#] )?` + regexp.QuoteMeta("ls=bob pwd="+filepath.Join(root, "bob")+"\r\nws=rw")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "bob", "notes")); err != nil {
+		t.Errorf("Expected the file in the workspace, %v", err)
+	}
+	// the sandbox of the runner is not changed by the session
+	if len(we.Sandbox.Hide) != 0 || len(we.Sandbox.Binds) != 0 {
+		t.Errorf("Expected the sandbox of the runner to be kept, got %+v", we.Sandbox)
+	}
+}
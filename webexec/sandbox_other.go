@@ -0,0 +1,9 @@
+//go:build !linux
+
+package webexec
+
+import "os/exec"
+
+func (sb *Sandbox) command(name string, args []string, env []string) (*exec.Cmd, error) {
+	return nil, ErrSandboxUnsupported
+}
@@ -0,0 +1,121 @@
+//go:build !windows
+
+package webexec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var signals = map[string]syscall.Signal{
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+}
+
+func (wes *WebExecSession) signal(name string) error {
+	sig, ok := signals[name]
+	if !ok {
+		return fmt.Errorf("unsupported signal %q, expected INT, TERM, HUP or QUIT", name)
+	}
+	if wes.cmd == nil || wes.cmd.Process == nil {
+		return errNotStarted
+	}
+	return wes.signalForeground(sig)
+}
+
+// signalForeground sends sig to the foreground process group of the terminal,
+// like the keys of the terminal do, or to the group of the command if it is unknown.
+func (wes *WebExecSession) signalForeground(sig syscall.Signal) error {
+	pgid := wes.cmd.Process.Pid
+	if conn, err := wes.tty.SyscallConn(); err == nil {
+		conn.Control(func(fd uintptr) {
+			if fg, err := unix.IoctlGetInt(int(fd), unix.TIOCGPGRP); err == nil && fg > 0 {
+				pgid = fg
+			}
+		})
+	}
+	return syscall.Kill(-pgid, sig)
+}
+
+// terminate ends the command, it is the leader of its own session:
+// SIGHUP first, SIGTERM after the grace period and SIGKILL last.
+// The processes left in the session, e.g. background jobs, are killed when the command exited.
+// In a PID namespace the command is the init of the sandbox, which forwards the signals
+// to the processes of the namespace, they are killed by the kernel when it exits.
+func (wes *WebExecSession) terminate(exited <-chan struct{}) {
+	sid := wes.cmd.Process.Pid
+	grace := wes.GracePeriod
+	if grace <= 0 {
+		grace = DefaultGracePeriod
+	}
+	pidNS := wes.Sandbox != nil && wes.Sandbox.Namespaces.PID
+	kill := func(sig syscall.Signal) {
+		if pidNS {
+			syscall.Kill(sid, sig)
+		} else {
+			signalSession(sid, sig)
+		}
+	}
+	kill(syscall.SIGHUP)
+	if !waitExit(exited, grace) {
+		kill(syscall.SIGTERM)
+		if !waitExit(exited, grace) {
+			kill(syscall.SIGKILL)
+			<-exited
+		}
+	}
+	if !pidNS {
+		signalSession(sid, syscall.SIGKILL)
+	}
+}
+
+func waitExit(exited <-chan struct{}, timeout time.Duration) bool {
+	select {
+	case <-exited:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// signalSession sends sig to every process group of the session
+func signalSession(sid int, sig syscall.Signal) {
+	for _, pgid := range sessionGroups(sid) {
+		syscall.Kill(-pgid, sig)
+	}
+}
+
+// sessionGroups returns the process groups of the session from /proc,
+// only the group of the session leader where there is no /proc.
+func sessionGroups(sid int) []int {
+	groups := []int{sid}
+	stats, _ := filepath.Glob("/proc/[0-9]*/stat")
+	for _, path := range stats {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue // the process exited
+		}
+		// pid (comm) state ppid pgrp session ..., comm may contain spaces and parentheses
+		s := string(b)
+		fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+		if len(fields) < 4 {
+			continue
+		}
+		pgrp, _ := strconv.Atoi(fields[2])
+		session, _ := strconv.Atoi(fields[3])
+		if session == sid && pgrp > 0 && !slices.Contains(groups, pgrp) {
+			groups = append(groups, pgrp)
+		}
+	}
+	return groups
+}
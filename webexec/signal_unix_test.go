@@ -0,0 +1,108 @@
+//go:build !windows
+
+package webexec
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm/webtermtest"
+)
+
+func readUntil(t *testing.T, s *WebExecSession, pattern string) []string {
+	t.Helper()
+	re := regexp.MustCompile(pattern)
+	var out []byte
+	buf := make([]byte, 1024)
+	deadline := time.AfterFunc(5*time.Second, func() { s.tty.Close() })
+	defer deadline.Stop()
+	for {
+		if m := re.FindSubmatch(out); m != nil {
+			groups := make([]string, len(m))
+			for i := range m {
+				groups[i] = string(m[i])
+			}
+			return groups
+		}
+		n, err := s.Read(buf)
+		out = append(out, buf[:n]...)
+		if err != nil {
+			t.Fatalf("Expected %q, got %q %v", pattern, out, err)
+		}
+	}
+}
+
+// alive reports whether the process exists and is not a zombie
+func alive(pid int) bool {
+	b, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	s := string(b)
+	fields := strings.Fields(s[strings.LastIndexByte(s, ')')+1:])
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestSignalControl(t *testing.T) {
+	we := &WebExec{Command: "sh", Args: []string{"-c", "trap 'echo got-INT' INT; trap 'echo got-QUIT' QUIT; echo ready; while :; do sleep 0.1; done"}}
+	h := webtermtest.NewHarness(t, we)
+	c := h.Connect()
+	c.ExpectOutput("ready")
+	c.Control(`{"signal": "INT"}`)
+	c.ExpectOutput("got-INT")
+	c.Control(`{"signal": "SIGQUIT"}`)
+	c.ExpectOutput("got-QUIT")
+
+	s, _ := we.Session()
+	if err := s.Control([]byte(`{"signal": "KILL"}`)); err == nil {
+		t.Errorf("Expected an unsupported signal error")
+	}
+}
+
+func TestGracefulClose(t *testing.T) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		t.Skip("no /proc")
+	}
+	dir := t.TempDir()
+	script := `set -m; sleep 100 & echo bg=$!; trap 'echo hup > ` + dir + `/hup; exit 0' HUP; echo ready; wait`
+	s := &WebExecSession{WebExec: WebExec{Command: "sh", Args: []string{"-c", script}}}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	bg, _ := strconv.Atoi(readUntil(t, s, `bg=(\d+)\s+ready`)[1])
+	start := time.Now()
+	s.Close()
+	if d := time.Since(start); d > DefaultGracePeriod {
+		t.Errorf("Expected the command to exit on SIGHUP, took %s", d)
+	}
+	if b, err := os.ReadFile(dir + "/hup"); err != nil || string(b) != "hup\n" {
+		t.Errorf("Expected the HUP trap to run, got %q %v", b, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if alive(bg) {
+		t.Errorf("Expected the background job %d to be killed", bg)
+	}
+}
+
+func TestCloseEscalation(t *testing.T) {
+	script := `trap '' HUP TERM; echo pid=$$; while :; do sleep 1; done`
+	s := &WebExecSession{WebExec: WebExec{Command: "sh", Args: []string{"-c", script}, GracePeriod: 100 * time.Millisecond}}
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pid, _ := strconv.Atoi(readUntil(t, s, `pid=(\d+)`)[1])
+	start := time.Now()
+	s.Close()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Expected SIGKILL after the grace periods, took %s", d)
+	}
+	if alive(pid) {
+		t.Errorf("Expected the command to be killed")
+	}
+}
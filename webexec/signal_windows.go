@@ -0,0 +1,15 @@
+//go:build windows
+
+package webexec
+
+import "errors"
+
+func (wes *WebExecSession) signal(name string) error {
+	return errors.ErrUnsupported
+}
+
+// terminate kills the command, Windows has no signals to ask it first
+func (wes *WebExecSession) terminate(exited <-chan struct{}) {
+	wes.cmd.Process.Kill()
+	<-exited
+}
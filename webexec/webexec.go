@@ -1,9 +1,25 @@
+// Package webexec is a runner of local commands in a pseudo terminal.
+//
+// A Sandbox with mounts, a hostname or rlimits is set up in the new process before the
+// command runs. The command is started through the server binary itself, /proc/self/exe,
+// with the argv0 "webexec-sandbox" and the sandbox in the WEBEXEC_SANDBOX variable:
+// the init function of this package sets up the sandbox and executes the command
+// instead of running the main function. Any binary importing this package on Linux
+// behaves so when it is started that way.
 package webexec
 
 import (
+	"encoding/json"
+	"errors"
 	"html/template"
+	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/OutOfBedlam/webterm"
 	"github.com/creack/pty"
@@ -11,13 +27,43 @@ import (
 
 var _ webterm.Runner = (*WebExec)(nil)
 var _ webterm.Session = (*WebExecSession)(nil)
+var _ webterm.SessionInfoSetter = (*WebExecSession)(nil)
 
 type WebExec struct {
 	Command string
 	Args    []string
 	Dir     string
+	// Sandbox restricts the command, nil runs it with the privileges of the server
+	Sandbox *Sandbox
+	// Persist runs the command in a tmux or screen session of the user,
+	// which survives the connection and the server, nil runs it directly.
+	Persist *Persist
+	// Workspace is the working directory of the principal instead of Dir, see Workspace
+	Workspace *Workspace
+
+	// Env are additional variables of the command, "KEY=value"
+	Env []string
+	// InheritEnv are the names of the variables of the server passed to the command,
+	// "LC_*" matches a prefix. DefaultInheritEnv if nil, none if empty.
+	// The other variables of the server, e.g. secrets, are not passed.
+	InheritEnv []string
+	// Term, ColorTerm and Lang set TERM, COLORTERM and LANG,
+	// DefaultTerm, DefaultColorTerm and the LANG of the server if empty.
+	Term      string
+	ColorTerm string
+	Lang      string
+	// SessionEnv returns the variables of a session, in addition to
+	// WEBTERM_SESSION_ID, WEBTERM_USER and WEBTERM_ROLES which are always set.
+	SessionEnv func(webterm.SessionInfo) []string
+
+	// GracePeriod is the time the command has to exit after SIGHUP, and then after SIGTERM,
+	// when the session is closed before it is killed, DefaultGracePeriod if zero.
+	// The processes left in its session, e.g. background jobs, are killed too.
+	GracePeriod time.Duration
 }
 
+const DefaultGracePeriod = 2 * time.Second
+
 func (we *WebExec) Session() (webterm.Session, error) {
 	return &WebExecSession{WebExec: *we}, nil
 }
@@ -28,15 +74,84 @@ func (we *WebExec) Template() (*template.Template, any) {
 
 type WebExecSession struct {
 	WebExec
-	cmd *exec.Cmd
-	tty *os.File
+	info      webterm.SessionInfo
+	workspace string // the directory of Workspace
+	cmd       *exec.Cmd
+	tty       *os.File
+	closeOnce sync.Once
 }
 
 func (wes *WebExecSession) Open() error {
-	wes.cmd = exec.Command(wes.Command, wes.Args...)
-	wes.cmd.Dir = wes.Dir
+	dir := wes.Dir
+	if wes.Workspace != nil {
+		if wes.Workspace.Ephemeral && wes.Persist != nil {
+			return errors.New("webexec ephemeral workspace can not be used with persist")
+		}
+		var owner *Credential
+		if wes.Sandbox != nil {
+			owner = wes.Sandbox.Credential
+		}
+		ws, err := wes.Workspace.open(wes.info.Principal.Name, owner)
+		if err != nil {
+			return err
+		}
+		wes.workspace, dir = ws, ws
+		if wes.Sandbox != nil {
+			// the command sees its own workspace only, the sandbox is copied for the session.
+			// The mounts are made in the working directory, the paths are absolute.
+			root, err := filepath.Abs(wes.Workspace.Root)
+			if err != nil {
+				wes.removeWorkspace()
+				return err
+			}
+			sb := *wes.Sandbox
+			sb.Hide = append(slices.Clip(sb.Hide), root)
+			sb.Binds = append(slices.Clip(sb.Binds), Bind{Source: filepath.Join(root, filepath.Base(ws)), Writable: true})
+			wes.Sandbox = &sb
+		}
+	}
+	if err := wes.start(dir); err != nil {
+		wes.removeWorkspace()
+		return err
+	}
+	return nil
+}
+
+func (wes *WebExecSession) start(dir string) error {
+	command, args, env := wes.Command, wes.Args, wes.environ()
+	if wes.Persist != nil {
+		if wes.info.Principal.Name == "" {
+			return ErrNoPersistUser
+		}
+		if wes.Sandbox != nil && wes.Sandbox.Namespaces.PID {
+			// the tmux or screen server would be killed with the namespace when the client exits
+			return errors.New("webexec persist can not be used with a PID namespace sandbox")
+		}
+		name := orDefault(wes.info.Query.Get("persist"), DefaultPersistName)
+		var err error
+		command, args, env, err = wes.Persist.command(wes.info.Principal.Name, name, dir, command, args, env)
+		if err != nil {
+			return err
+		}
+	}
+	if wes.Sandbox != nil {
+		cmd, err := wes.Sandbox.command(command, args, env)
+		if err != nil {
+			return err
+		}
+		wes.cmd = cmd
+	} else {
+		wes.cmd = exec.Command(command, args...)
+		wes.cmd.Env = env
+	}
+	wes.cmd.Dir = dir
 
-	if tty, err := pty.Start(wes.cmd); err != nil {
+	// start with the size of the client, the command may never see a resize
+	var sz *pty.Winsize
+	if wes.info.Cols > 0 {
+		sz = &pty.Winsize{Cols: uint16(wes.info.Cols), Rows: uint16(wes.info.Rows)}
+	}
+	if tty, err := pty.StartWithSize(wes.cmd, sz); err != nil {
 		return err
 	} else {
 		wes.tty = tty
@@ -44,20 +159,35 @@ func (wes *WebExecSession) Open() error {
 	return nil
 }
 
+// Close terminates the command gracefully, see GracePeriod
 func (wes *WebExecSession) Close() error {
-	if wes.cmd != nil {
-		if wes.cmd.Process != nil {
-			wes.cmd.Process.Kill()
+	wes.closeOnce.Do(func() {
+		if wes.cmd != nil && wes.cmd.Process != nil {
+			exited := make(chan struct{})
+			go func() {
+				wes.cmd.Wait()
+				close(exited)
+			}()
+			wes.terminate(exited)
 		}
-		wes.cmd.Wait()
-	}
-	if wes.tty != nil {
-		wes.tty.Close()
-		wes.tty = nil
-	}
+		// tty is kept, Read and Write may still run and fail with os.ErrClosed
+		if wes.tty != nil {
+			wes.tty.Close()
+		}
+		wes.removeWorkspace()
+	})
 	return nil
 }
 
+// removeWorkspace removes an ephemeral workspace
+func (wes *WebExecSession) removeWorkspace() {
+	if wes.workspace != "" && wes.Workspace.Ephemeral {
+		if err := os.RemoveAll(wes.workspace); err != nil {
+			slog.Error("webexec failed to remove workspace", "dir", wes.workspace, "error", err)
+		}
+	}
+}
+
 func (wes *WebExecSession) Read(p []byte) (n int, err error) {
 	return wes.tty.Read(p)
 }
@@ -70,6 +200,22 @@ func (wes *WebExecSession) SetWinSize(cols int, rows int) error {
 	return pty.Setsize(wes.tty, &pty.Winsize{Cols: uint16(cols), Rows: uint16(rows)})
 }
 
+// ControlMessage is a control message of a webexec session, e.g. {"signal": "INT"}
+type ControlMessage struct {
+	// Signal is sent to the foreground process group of the terminal:
+	// INT, TERM, HUP or QUIT, with or without the SIG prefix
+	Signal string `json:"signal,omitempty"`
+}
+
+var errNotStarted = errors.New("webexec command is not started")
+
 func (wes *WebExecSession) Control(data []byte) error {
+	var m ControlMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	if m.Signal != "" {
+		return wes.signal(strings.TrimPrefix(strings.ToUpper(m.Signal), "SIG"))
+	}
 	return nil
 }
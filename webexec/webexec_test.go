@@ -0,0 +1,94 @@
+package webexec
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/OutOfBedlam/webterm/webclient"
+	"github.com/OutOfBedlam/webterm/webtermtest"
+)
+
+func TestConformance(t *testing.T) {
+	we := &WebExec{Command: "sh"}
+	webtermtest.TestSession(t, we.Session)
+	webtermtest.TestRunner(t, we)
+}
+
+func TestEnviron(t *testing.T) {
+	t.Setenv("SECRET_TOKEN", "s3cret")
+	t.Setenv("LC_TIME", "C")
+	t.Setenv("LANG", "")
+	tests := []struct {
+		name    string
+		we      WebExec
+		expect  []string
+		missing []string
+	}{
+		{
+			name:    "default",
+			expect:  []string{"LC_TIME=C", "TERM=xterm-256color", "COLORTERM=truecolor", "LANG=C.UTF-8"},
+			missing: []string{"SECRET_TOKEN=s3cret"},
+		},
+		{
+			name:    "allowlist",
+			we:      WebExec{InheritEnv: []string{"SECRET_*"}, Term: "xterm", Lang: "ko_KR.UTF-8"},
+			expect:  []string{"SECRET_TOKEN=s3cret", "TERM=xterm", "LANG=ko_KR.UTF-8"},
+			missing: []string{"LC_TIME=C"},
+		},
+		{
+			name:    "none",
+			we:      WebExec{InheritEnv: []string{}, Env: []string{"EDITOR=vi"}},
+			expect:  []string{"EDITOR=vi", "TERM=xterm-256color"},
+			missing: []string{"LC_TIME=C", "SECRET_TOKEN=s3cret"},
+		},
+	}
+	for _, tt := range tests {
+		wes := &WebExecSession{WebExec: tt.we}
+		env := wes.environ()
+		for _, kv := range tt.expect {
+			if !slices.Contains(env, kv) {
+				t.Errorf("%s: expected %s in %q", tt.name, kv, env)
+			}
+		}
+		for _, kv := range tt.missing {
+			if slices.Contains(env, kv) {
+				t.Errorf("%s: unexpected %s", tt.name, kv)
+			}
+		}
+	}
+}
+
+func TestSessionEnv(t *testing.T) {
+	t.Setenv("SECRET_TOKEN", "s3cret")
+	we := &WebExec{
+		Command: "sh",
+		Args:    []string{"-c", "env; echo END; read line"},
+		SessionEnv: func(info webterm.SessionInfo) []string {
+			return []string{"GREETING=hello " + info.Principal.Name}
+		},
+	}
+	h := webtermtest.NewHarness(t, we, webterm.WithAuthenticator(func(r *http.Request) (webterm.Principal, error) {
+		return webterm.Principal{Name: "alice", Roles: []string{"dev", "ops"}}, nil
+	}))
+	c := h.Connect()
+	id := c.Session().ID
+	out := c.ExpectOutput("\nEND")
+	for _, kv := range []string{"WEBTERM_SESSION_ID=" + id, "WEBTERM_USER=alice", "WEBTERM_ROLES=dev,ops", "GREETING=hello alice"} {
+		if !strings.Contains(out, kv) {
+			t.Errorf("Expected %s in %q", kv, out)
+		}
+	}
+	if strings.Contains(out, "SECRET_TOKEN") {
+		t.Errorf("Unexpected server secret in %q", out)
+	}
+}
+
+func TestInitialWinSize(t *testing.T) {
+	we := &WebExec{Command: "sh", Args: []string{"-c", "stty size; read line"}}
+	h := webtermtest.NewHarness(t, we)
+	c := h.Connect(webclient.WithSize(120, 40))
+	c.ExpectOutput("40 120")
+}
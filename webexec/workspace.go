@@ -0,0 +1,166 @@
+package webexec
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Workspace gives every principal a working directory of its own, <Root>/<user>,
+// instead of WebExec.Dir. A missing workspace is created from the Skeleton.
+//
+// Without a Sandbox the workspaces are separate directories only, the commands run as
+// the server and can reach all of them. In a Sandbox the Root is hidden and the workspace
+// of the user alone is bound writable into it, also with ReadOnlyRoot. If the command runs
+// as another user, Sandbox.Credential, the workspace is owned by it. All users share that
+// credential though, and without a PID namespace a command can reach the workspaces of the
+// other sessions through their processes, e.g. /proc/<pid>/cwd, use a PID namespace for
+// isolated workspaces.
+type Workspace struct {
+	Root     string      `json:"root"`               // e.g. "/srv/workspaces"
+	Skeleton string      `json:"skeleton,omitempty"` // copied into new workspaces, e.g. "/etc/skel"
+	Mode     fs.FileMode `json:"mode,omitempty"`     // of the workspace directory, 0700 if zero
+	// Home sets HOME of the command to the workspace
+	Home bool `json:"home,omitempty"`
+	// Ephemeral gives every session a new temporary workspace, <Root>/<user>-<random>,
+	// which is removed when the session is closed. It can not be used with Persist.
+	Ephemeral bool `json:"ephemeral,omitempty"`
+}
+
+var ErrNoWorkspaceUser = errors.New("webexec workspace requires an authenticated user")
+
+// workspaceMu serializes the creation of the workspaces
+var workspaceMu sync.Mutex
+
+// open returns the workspace of the user, it is created if it does not exist.
+// owner is the credential of the command, nil for the server itself.
+func (w *Workspace) open(user string, owner *Credential) (string, error) {
+	if user == "" {
+		return "", ErrNoWorkspaceUser
+	}
+	if user == "." || user == ".." || strings.ContainsAny(user, "/\\\x00") {
+		return "", fmt.Errorf("webexec invalid user name %q for a workspace", user)
+	}
+	if err := os.MkdirAll(w.Root, 0o755); err != nil {
+		return "", err
+	}
+	if w.Ephemeral {
+		dir, err := os.MkdirTemp(w.Root, user+"-*")
+		if err != nil {
+			return "", err
+		}
+		if err := w.populate(dir, owner); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+		return dir, nil
+	}
+	dir := filepath.Join(w.Root, user)
+	// the concurrent sessions of the server wait for the skeleton
+	workspaceMu.Lock()
+	defer workspaceMu.Unlock()
+	if _, err := os.Lstat(dir); err == nil {
+		return dir, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	// populated in a temporary directory and renamed into place, a workspace is complete
+	// even if the server dies meanwhile, and another process can not be replaced
+	tmp, err := os.MkdirTemp(w.Root, "."+user+".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	if err := w.populate(tmp, owner); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if err := renameNoReplace(tmp, dir); err != nil {
+		os.RemoveAll(tmp)
+		if errors.Is(err, fs.ErrExist) {
+			return dir, nil // created by another process
+		}
+		return "", err
+	}
+	return dir, nil
+}
+
+// populate copies the skeleton into dir and sets its mode and owner
+func (w *Workspace) populate(dir string, owner *Credential) error {
+	if w.Skeleton != "" {
+		if err := copyTree(w.Skeleton, dir); err != nil {
+			return err
+		}
+	}
+	mode := w.Mode
+	if mode == 0 {
+		mode = 0o700
+	}
+	if err := os.Chmod(dir, mode); err != nil {
+		return err
+	}
+	if owner == nil {
+		return nil
+	}
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, int(owner.UID), int(owner.GID))
+	})
+}
+
+// copyTree copies the directories, regular files and symbolic links of src into dst
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			if rel == "." {
+				return nil
+			}
+			return os.Mkdir(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil // devices, sockets and pipes are skipped
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package webexec
+
+import (
+	"io/fs"
+	"os"
+)
+
+// renameNoReplace renames oldpath to newpath, it fails with fs.ErrExist if newpath exists.
+// The check is not atomic, an empty directory created meanwhile is replaced.
+func renameNoReplace(oldpath, newpath string) error {
+	if _, err := os.Lstat(newpath); err == nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrExist}
+	}
+	return os.Rename(oldpath, newpath)
+}
@@ -0,0 +1,138 @@
+package webexec
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/OutOfBedlam/webterm/webtermtest"
+)
+
+func testSkeleton(t *testing.T) string {
+	t.Helper()
+	skel := t.TempDir()
+	os.WriteFile(filepath.Join(skel, ".profile"), []byte("export PS1='$ '\n"), 0o644)
+	os.Mkdir(filepath.Join(skel, "bin"), 0o755)
+	os.WriteFile(filepath.Join(skel, "bin", "hello"), []byte("#!/bin/sh\necho hello\n"), 0o755)
+	os.Symlink(".profile", filepath.Join(skel, ".bashrc"))
+	return skel
+}
+
+func TestWorkspaceOpen(t *testing.T) {
+	w := &Workspace{Root: filepath.Join(t.TempDir(), "workspaces"), Skeleton: testSkeleton(t)}
+	var wg sync.WaitGroup
+	dirs := make([]string, 4)
+	errs := make([]error, 4)
+	for i := range dirs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dirs[i], errs[i] = w.open("alice", nil)
+		}()
+	}
+	wg.Wait()
+	expect := filepath.Join(w.Root, "alice")
+	for i := range dirs {
+		if errs[i] != nil || dirs[i] != expect {
+			t.Fatalf("Expected workspace %s, got %s %v", expect, dirs[i], errs[i])
+		}
+	}
+	if fi, err := os.Stat(expect); err != nil || fi.Mode().Perm() != 0o700 {
+		t.Errorf("Expected mode 0700, got %v %v", fi.Mode(), err)
+	}
+	if fi, err := os.Stat(filepath.Join(expect, "bin", "hello")); err != nil || fi.Mode().Perm() != 0o755 {
+		t.Errorf("Expected the executable of the skeleton, got %v", err)
+	}
+	if link, err := os.Readlink(filepath.Join(expect, ".bashrc")); err != nil || link != ".profile" {
+		t.Errorf("Expected the symbolic link of the skeleton, got %q %v", link, err)
+	}
+	// the files of the user are kept
+	os.WriteFile(filepath.Join(expect, "notes"), []byte("x"), 0o600)
+	if _, err := w.open("alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(expect, "notes")); err != nil {
+		t.Errorf("Expected the workspace to be kept: %v", err)
+	}
+	if entries, _ := os.ReadDir(w.Root); len(entries) != 1 {
+		t.Errorf("Expected only the workspace of alice, got %v", entries)
+	}
+
+	// without a skeleton the concurrent sessions share one empty workspace, none is replaced
+	empty := &Workspace{Root: w.Root}
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if dir, err := empty.open("carol", nil); err == nil {
+				os.WriteFile(filepath.Join(dir, strconv.Itoa(i)), nil, 0o600)
+			}
+		}()
+	}
+	wg.Wait()
+	if entries, err := os.ReadDir(filepath.Join(w.Root, "carol")); err != nil || len(entries) != 8 {
+		t.Errorf("Expected the files of all sessions in the workspace, got %v %v", entries, err)
+	}
+
+	// a workspace is renamed into place, it never replaces one
+	tmp := t.TempDir()
+	if err := renameNoReplace(tmp, expect); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected fs.ErrExist, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(expect, "notes")); err != nil {
+		t.Errorf("Expected the workspace to be kept: %v", err)
+	}
+
+	for _, user := range []string{"", "..", "a/b"} {
+		if _, err := w.open(user, nil); err == nil {
+			t.Errorf("Expected an error for the user %q", user)
+		}
+	}
+	if _, err := w.open("", nil); !errors.Is(err, ErrNoWorkspaceUser) {
+		t.Errorf("Expected ErrNoWorkspaceUser, got %v", err)
+	}
+}
+
+func TestWorkspaceSession(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		name string
+		w    Workspace
+	}{
+		{"persistent", Workspace{Root: root, Skeleton: testSkeleton(t), Home: true}},
+		{"ephemeral", Workspace{Root: root, Skeleton: testSkeleton(t), Home: true, Ephemeral: true}},
+	}
+	for _, tt := range tests {
+		we := &WebExec{Command: "sh", Args: []string{"-c", "bin/hello; echo HOME=$HOME; echo PWD=$(pwd); echo END; read line"}, Workspace: &tt.w}
+		h := webtermtest.NewHarness(t, we, webterm.WithAuthenticator(func(r *http.Request) (webterm.Principal, error) {
+			return webterm.Principal{Name: "bob"}, nil
+		}))
+		c := h.Connect()
+		var home, dir string
+		for _, line := range strings.Split(c.ExpectOutput("\nEND"), "\r\n") {
+			if v, ok := strings.CutPrefix(line, "HOME="); ok {
+				home = v
+			} else if v, ok := strings.CutPrefix(line, "PWD="); ok {
+				dir = v
+			}
+		}
+		if !strings.HasPrefix(dir, filepath.Join(root, "bob")) || home != dir {
+			t.Errorf("%s: expected the workspace of bob as HOME and working directory, got %q %q", tt.name, home, dir)
+		}
+		c.Close()
+		h.ExpectSessions(0)
+		_, err := os.Stat(dir)
+		if tt.w.Ephemeral && !os.IsNotExist(err) {
+			t.Errorf("%s: expected the workspace to be removed, got %v", tt.name, err)
+		} else if !tt.w.Ephemeral && err != nil {
+			t.Errorf("%s: expected the workspace to be kept, got %v", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+// Package webexpect scripts a webterm.Session like expect(1): it sends input,
+// waits for a regular expression in the output and continues with the matched groups.
+// It works directly on the sessions of the runners, e.g. webexec and webssh, without a browser.
+package webexpect
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+)
+
+// DefaultTimeout is the timeout of Expect unless WithTimeout is given
+const DefaultTimeout = 10 * time.Second
+
+// ErrTimeout is returned, wrapped, when the output does not match in time
+var ErrTimeout = errors.New("expect timeout")
+
+type Option func(*Expect)
+
+// WithTimeout sets the timeout of Expect
+func WithTimeout(timeout time.Duration) Option {
+	return func(e *Expect) {
+		e.timeout = timeout
+	}
+}
+
+// WithTranscript records the raw output of the session to w as it is read, like script(1).
+// The input is recorded as far as the terminal echoes it, so passwords typed at a prompt are not.
+func WithTranscript(w io.Writer) Option {
+	return func(e *Expect) {
+		e.transcript = w
+	}
+}
+
+// WithSize sets the window size of the session, 80x24 by default
+func WithSize(cols, rows int) Option {
+	return func(e *Expect) {
+		e.cols, e.rows = cols, rows
+	}
+}
+
+// WithStripAnsi matches the patterns against the output without escape sequences,
+// e.g. the colors of a prompt. The CR of CRLF line endings is removed too.
+func WithStripAnsi() Option {
+	return func(e *Expect) {
+		e.strip = true
+	}
+}
+
+// Expect drives a session, its output is read in the background
+// and kept until it is consumed by a match.
+type Expect struct {
+	session    webterm.Session
+	timeout    time.Duration
+	transcript io.Writer
+	cols, rows int
+	strip      bool
+	parser     webterm.AnsiParser
+
+	mu      sync.Mutex
+	buf     []byte        // output not consumed yet
+	changed chan struct{} // closed when buf or err changes
+	err     error         // the error of Read, io.EOF when the session ended
+	done    chan struct{}
+}
+
+// Spawn opens a new session of the runner
+func Spawn(runner webterm.Runner, opts ...Option) (*Expect, error) {
+	session, err := runner.Session()
+	if err != nil {
+		return nil, err
+	}
+	if err := session.Open(); err != nil {
+		return nil, err
+	}
+	return New(session, opts...)
+}
+
+// New drives an opened session, Close closes it
+func New(session webterm.Session, opts ...Option) (*Expect, error) {
+	e := &Expect{
+		session: session,
+		timeout: DefaultTimeout,
+		cols:    80,
+		rows:    24,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if err := session.SetWinSize(e.cols, e.rows); err != nil {
+		session.Close()
+		return nil, err
+	}
+	go e.read()
+	return e, nil
+}
+
+func (e *Expect) read() {
+	defer close(e.done)
+	p := make([]byte, 4096)
+	for {
+		n, err := e.session.Read(p)
+		e.mu.Lock()
+		if n > 0 {
+			if e.transcript != nil {
+				e.transcript.Write(p[:n])
+			}
+			e.append(p[:n])
+		}
+		if err != nil {
+			e.err = err
+		}
+		close(e.changed)
+		e.changed = make(chan struct{})
+		e.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// append adds the output to buf, it is called with e.mu held.
+func (e *Expect) append(p []byte) {
+	if !e.strip {
+		e.buf = append(e.buf, p...)
+		return
+	}
+	e.parser.Feed(p, func(tok webterm.AnsiToken) {
+		switch tok.Kind {
+		case webterm.AnsiText:
+			e.buf = append(e.buf, tok.Data...)
+		case webterm.AnsiControl:
+			if tok.Final == '\n' || tok.Final == '\t' {
+				e.buf = append(e.buf, tok.Final)
+			}
+		}
+	})
+}
+
+// Send writes the input to the session
+func (e *Expect) Send(input string) error {
+	_, err := io.WriteString(e.session, input)
+	return err
+}
+
+// SendLine sends the input followed by Enter
+func (e *Expect) SendLine(input string) error {
+	return e.Send(input + "\r")
+}
+
+// Match is the result of Expect
+type Match struct {
+	// Groups are the matched text and the submatches of the pattern,
+	// Groups[1] is the first parenthesized group
+	Groups []string
+	// Before is the output between the previous match and this one
+	Before string
+}
+
+// Expect waits until the output matches the pattern, within the timeout of WithTimeout.
+// The output up to the end of the match is consumed.
+func (e *Expect) Expect(pattern string) (Match, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Match{}, err
+	}
+	return e.ExpectRegexp(re, e.timeout)
+}
+
+// ExpectRegexp waits up to timeout until the output matches re.
+// It returns an error wrapping ErrTimeout, or the error of the session if it ended before.
+func (e *Expect) ExpectRegexp(re *regexp.Regexp, timeout time.Duration) (Match, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		e.mu.Lock()
+		if loc := re.FindSubmatchIndex(e.buf); loc != nil {
+			m := Match{Before: string(e.buf[:loc[0]])}
+			for i := 0; i < len(loc); i += 2 {
+				if loc[i] >= 0 {
+					m.Groups = append(m.Groups, string(e.buf[loc[i]:loc[i+1]]))
+				} else {
+					m.Groups = append(m.Groups, "")
+				}
+			}
+			e.buf = e.buf[loc[1]:]
+			e.mu.Unlock()
+			return m, nil
+		}
+		if e.err != nil {
+			err := e.err
+			e.mu.Unlock()
+			return Match{}, fmt.Errorf("%q not found: %w", re, err)
+		}
+		changed := e.changed
+		e.mu.Unlock()
+		select {
+		case <-changed:
+		case <-timer.C:
+			return Match{}, fmt.Errorf("%w: %q not found in %q", ErrTimeout, re, e.tail(200))
+		}
+	}
+}
+
+// tail returns the last n bytes of the output not consumed yet
+func (e *Expect) tail(n int) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.buf) > n {
+		return string(e.buf[len(e.buf)-n:])
+	}
+	return string(e.buf)
+}
+
+// Wait waits until the session ends, e.g. after sending "exit", and returns the rest of the output.
+// Any error of Read ends the session, a pty returns EIO when the process exits.
+func (e *Expect) Wait() (string, error) {
+	timer := time.NewTimer(e.timeout)
+	defer timer.Stop()
+	select {
+	case <-e.done:
+	case <-timer.C:
+		return e.tail(200), fmt.Errorf("%w: the session did not end", ErrTimeout)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rest := string(e.buf)
+	e.buf = nil
+	return rest, nil
+}
+
+// Close closes the session and waits until its output is read
+func (e *Expect) Close() error {
+	err := e.session.Close()
+	<-e.done
+	return err
+}
@@ -0,0 +1,112 @@
+package webexpect
+
+import (
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm/webexec"
+	"github.com/OutOfBedlam/webterm/webtermtest"
+)
+
+func TestExpect(t *testing.T) {
+	session := webtermtest.NewSession(
+		webtermtest.Step{Output: "login: "},
+		webtermtest.Step{Expect: "admin\r", Output: "admin\r\nLast login: today\r\nadmin@web1:~$ "},
+		webtermtest.Step{Expect: "uptime\r", Output: "uptime\r\n up 12 days, load average: 0.42\r\nadmin@web1:~$ "},
+		webtermtest.Step{Expect: "exit\r", Output: "exit\r\nlogout\r\n", Exit: true},
+	)
+	session.Open()
+	var transcript strings.Builder
+	e, err := New(session, WithTranscript(&transcript), WithSize(120, 40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	session.ExpectSize(t, 120, 40)
+
+	if _, err := e.Expect(`login: $`); err != nil {
+		t.Fatal(err)
+	}
+	e.SendLine("admin")
+	m, err := e.Expect(`(\w+)@(\w+):~\$ `)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Groups) != 3 || m.Groups[1] != "admin" || m.Groups[2] != "web1" {
+		t.Errorf("Unexpected groups %q", m.Groups)
+	}
+	if m.Before != "admin\r\nLast login: today\r\n" {
+		t.Errorf("Unexpected before %q", m.Before)
+	}
+	e.SendLine("uptime")
+	m, err = e.Expect(`load average: ([\d.]+)`)
+	if err != nil || m.Groups[1] != "0.42" {
+		t.Fatalf("Unexpected match %q %v", m.Groups, err)
+	}
+	e.Expect(`\$ $`)
+	e.SendLine("exit")
+	rest, err := e.Wait()
+	if err != nil || rest != "exit\r\nlogout\r\n" {
+		t.Errorf("Unexpected rest %q %v", rest, err)
+	}
+	if _, err := e.Expect(`more`); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected EOF after the session ended, got %v", err)
+	}
+	if !strings.HasPrefix(transcript.String(), "login: admin\r\n") || !strings.HasSuffix(transcript.String(), "logout\r\n") {
+		t.Errorf("Unexpected transcript %q", transcript.String())
+	}
+}
+
+func TestExpectTimeout(t *testing.T) {
+	session := webtermtest.NewSession(webtermtest.Step{Output: "$ "})
+	session.Open()
+	e, err := New(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	_, err = e.ExpectRegexp(regexp.MustCompile(`never`), 50*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) || !strings.Contains(err.Error(), `"$ "`) {
+		t.Errorf("Expected timeout with the output, got %v", err)
+	}
+	if _, err := e.Expect(`[`); err == nil {
+		t.Errorf("Expected an invalid pattern error")
+	}
+	if _, err := e.Expect(`\$ `); err != nil {
+		t.Errorf("Expected the output to be kept after a timeout, got %v", err)
+	}
+}
+
+func TestStripAnsi(t *testing.T) {
+	session := webtermtest.NewSession(webtermtest.Step{Output: "\x1b[1;32muser@host\x1b[0m:\x1b[34m~\x1b[0m$ ok\r\n"})
+	session.Open()
+	e, err := New(session, WithStripAnsi())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if _, err := e.Expect(`user@host:~\$ ok\n`); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWebExec(t *testing.T) {
+	e, err := Spawn(&webexec.WebExec{Command: "sh"}, WithTimeout(5*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	e.SendLine("echo result=$((6*7))")
+	m, err := e.Expect(`result=(\d+)`)
+	if err != nil || m.Groups[1] != "42" {
+		t.Fatalf("Unexpected match %q %v", m.Groups, err)
+	}
+	e.SendLine("exit")
+	if _, err := e.Wait(); err != nil {
+		t.Error(err)
+	}
+}
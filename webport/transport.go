@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/gorilla/websocket"
@@ -94,20 +95,26 @@ func (ab AddrBind) String() string {
 }
 
 func ParseAddrBind(spec string) (*AddrBind, error) {
-	var localIP, remoteIP string
-	var localPort, remotePort int
-	n, err := fmt.Sscanf(spec, "%[^:]:%d:%[^:]:%d", &localIP, &localPort, &remoteIP, &remotePort)
-	if err != nil || (n != 4 && n != 3) {
+	parts := strings.Split(spec, ":")
+	if len(parts) == 3 {
+		// no local_ip specified
+		parts = append([]string{""}, parts...)
+	}
+	if len(parts) != 4 {
 		return nil, fmt.Errorf("invalid port forwarding specification: %s", spec)
 	}
-	if n == 3 {
-		// no local_ip specified
-		localIP = ""
+	localPort, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid port forwarding specification: %s", spec)
+	}
+	remotePort, err := strconv.Atoi(parts[3])
+	if err != nil || parts[2] == "" {
+		return nil, fmt.Errorf("invalid port forwarding specification: %s", spec)
 	}
 	return &AddrBind{
-		LocalIP:    localIP,
+		LocalIP:    parts[0],
 		LocalPort:  localPort,
-		RemoteIP:   remoteIP,
+		RemoteIP:   parts[2],
 		RemotePort: remotePort,
 	}, nil
 }
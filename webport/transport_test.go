@@ -163,6 +163,31 @@ func TestOrChans(t *testing.T) {
 	}
 }
 
+func TestParseAddrBind(t *testing.T) {
+	tests := []struct {
+		spec   string
+		expect *AddrBind
+	}{
+		{"8080:127.0.0.1:22", &AddrBind{LocalPort: 8080, RemoteIP: "127.0.0.1", RemotePort: 22}},
+		{"127.0.0.1:8080:10.0.0.1:22", &AddrBind{LocalIP: "127.0.0.1", LocalPort: 8080, RemoteIP: "10.0.0.1", RemotePort: 22}},
+		{"8080:22", nil},
+		{"x:127.0.0.1:22", nil},
+		{"8080::22", nil},
+	}
+	for _, tt := range tests {
+		ab, err := ParseAddrBind(tt.spec)
+		if tt.expect == nil {
+			if err == nil {
+				t.Errorf("%s: expected error, got %v", tt.spec, ab)
+			}
+			continue
+		}
+		if err != nil || *ab != *tt.expect {
+			t.Errorf("%s: expected %v, got %v %v", tt.spec, tt.expect, ab, err)
+		}
+	}
+}
+
 // Helper function to check if error is a closed connection error
 func isClosedError(err error) bool {
 	if err == nil {
@@ -1,11 +1,13 @@
 package webport
 
 import (
+	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -13,6 +15,8 @@ import (
 type Config struct {
 	LocalAddr  string
 	RemoteAddr string
+	// TLS makes the local listener accept TLS connections, set ClientAuth for mutual TLS
+	TLS *tls.Config
 }
 
 func New(conf Config) (*WebPort, error) {
@@ -36,6 +40,7 @@ func New(conf Config) (*WebPort, error) {
 	ret := &WebPort{
 		localAddr:  localAddr,
 		remoteAddr: remoteAddr,
+		tlsConfig:  conf.TLS,
 		done:       make(chan struct{}),
 	}
 
@@ -45,6 +50,7 @@ func New(conf Config) (*WebPort, error) {
 type WebPort struct {
 	localAddr  *Addr
 	remoteAddr *Addr
+	tlsConfig  *tls.Config
 	lsnr       net.Listener
 	err        error
 	done       chan struct{}
@@ -60,6 +66,9 @@ func (wp *WebPort) Start() error {
 	} else {
 		wp.lsnr = lsnr
 	}
+	if wp.tlsConfig != nil {
+		wp.lsnr = tls.NewListener(wp.lsnr, wp.tlsConfig)
+	}
 	wp.wg.Add(1)
 	go func() {
 		defer wp.wg.Done()
@@ -96,8 +105,23 @@ func (wp *WebPort) Err() error {
 	return wp.err
 }
 
+// handshakeTimeout bounds the TLS handshake, a client that never completes it is disconnected
+var handshakeTimeout = 10 * time.Second
+
 func (wp *WebPort) handleConnection(localConn net.Conn, remoteAddr *Addr) {
 	defer localConn.Close()
+	var principal string
+	if tc, ok := localConn.(*tls.Conn); ok {
+		tc.SetDeadline(time.Now().Add(handshakeTimeout))
+		if err := tc.Handshake(); err != nil {
+			slog.Warn("tls handshake failed", "client", localConn.RemoteAddr(), "error", err)
+			return
+		}
+		tc.SetDeadline(time.Time{})
+		if chains := tc.ConnectionState().VerifiedChains; len(chains) > 0 {
+			principal = chains[0][0].Subject.String()
+		}
+	}
 	remoteConn, err := remoteAddr.Dial()
 	if err != nil {
 		slog.Error("failed to connect to remote address", "error", err)
@@ -105,7 +129,7 @@ func (wp *WebPort) handleConnection(localConn net.Conn, remoteAddr *Addr) {
 	}
 	defer remoteConn.Close()
 
-	slog.Debug("connection start", "client", localConn.RemoteAddr(), "remote", wp.remoteAddr.String())
+	slog.Debug("connection start", "client", localConn.RemoteAddr(), "principal", principal, "remote", wp.remoteAddr.String())
 	PumpBiDirectional(localConn, remoteConn, wp.done)
 	slog.Debug("connection closed", "client", localConn.RemoteAddr())
 }
@@ -0,0 +1,81 @@
+package webport
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+)
+
+func TestWebPortTLS(t *testing.T) {
+	defer func(d time.Duration) { handshakeTimeout = d }(handshakeTimeout)
+	handshakeTimeout = 100 * time.Millisecond
+	// an echo server as the remote
+	remote, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	go func() {
+		for {
+			conn, err := remote.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	cert, err := webterm.SelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// find a free local port
+	lis, _ := net.Listen("tcp", "127.0.0.1:0")
+	port := lis.Addr().(*net.TCPAddr).Port
+	lis.Close()
+
+	wp, err := New(Config{
+		LocalAddr:  fmt.Sprintf("tcp://127.0.0.1:%d", port),
+		RemoteAddr: "tcp://" + remote.Addr().String(),
+		TLS:        &tls.Config{Certificates: []tls.Certificate{cert}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wp.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer wp.Stop()
+
+	conn, err := tls.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("Failed to dial tls: %v", err)
+	}
+	defer conn.Close()
+	// the deadline of the handshake is cleared
+	time.Sleep(2 * handshakeTimeout)
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("Expected hello through the tls port, got %q %v", buf, err)
+	}
+
+	// a client which does not start the handshake is disconnected
+	raw, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	raw.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := raw.Read(buf); err != io.EOF {
+		t.Errorf("Expected the connection to be closed after the handshake timeout, got %v", err)
+	}
+}
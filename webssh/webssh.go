@@ -66,6 +66,7 @@ func (hops Hops) Connect() (*ssh.Client, error) {
 
 var _ webterm.Runner = (*WebSSH)(nil)
 var _ webterm.Session = (*WebSSHSession)(nil)
+var _ webterm.SessionInfoSetter = (*WebSSHSession)(nil)
 
 type WebSSH struct {
 	Hops     Hops
@@ -84,6 +85,7 @@ func (ws *WebSSH) Template() (*template.Template, any) {
 type WebSSHSession struct {
 	WebSSH
 
+	info    webterm.SessionInfo
 	conn    *ssh.Client
 	session *ssh.Session
 	reader  io.Reader
@@ -123,7 +125,11 @@ func (ws *WebSSHSession) Open() error {
 	if termType == "" {
 		termType = "xterm"
 	}
-	err = ws.session.RequestPty(termType, 40, 80, ssh.TerminalModes{
+	rows, cols := 40, 80
+	if ws.info.Cols > 0 {
+		rows, cols = ws.info.Rows, ws.info.Cols
+	}
+	err = ws.session.RequestPty(termType, rows, cols, ssh.TerminalModes{
 		ssh.ECHO: 1, // enable echoing
 	})
 	if err != nil {
@@ -174,3 +180,9 @@ func (ws *WebSSHSession) SetWinSize(cols, rows int) error {
 func (ws *WebSSHSession) Control(data []byte) error {
 	return nil
 }
+
+// SetSessionInfo implements webterm.SessionInfoSetter,
+// the pty is requested with the window size of the client.
+func (ws *WebSSHSession) SetSessionInfo(info webterm.SessionInfo) {
+	ws.info = info
+}
@@ -3,11 +3,13 @@ package webterm
 import (
 	"embed"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/creack/pty"
 	"github.com/gorilla/websocket"
@@ -28,14 +30,55 @@ type Session interface {
 	Control(data []byte) error // handle messages from client
 }
 
+// SessionInfoSetter is an optional interface of a Session. WebTerm calls SetSessionInfo
+// before Open, e.g. to pass the session ID and the principal to the command of the session.
+type SessionInfoSetter interface {
+	SetSessionInfo(info SessionInfo)
+}
+
 type WebTerm struct {
-	runner          Runner
-	fsServer        http.Handler
+	page
+	runner         Runner
+	exportEnabled  bool
+	reg            *registry // the live sessions, shared with the WebTerm that replaces it
+	shareSecret    []byte
+	shutdownNotice string
+	authenticator  Authenticator
+	limits         Limits
+	observers      observers
+	middleware     []SessionMiddleware
+	clipboard      *ClipboardPolicy // nil passes OSC 52 through
+	macros         []Macro
+}
+
+// page is the options of the pages, shared by WebTerm and Broadcast
+type page struct {
 	cutPrefix       string
 	terminalOptions TerminalOptions
 	localization    map[string]string
 }
 
+func defaultPage() page {
+	return page{terminalOptions: DefaultTerminalOptions()}
+}
+
+// pageOf returns the page options of opts, the other options are ignored
+func pageOf(opts []Option) page {
+	wt := &WebTerm{page: defaultPage()}
+	for _, opt := range opts {
+		opt(wt)
+	}
+	wt.page.cleanPrefix()
+	return wt.page
+}
+
+// cleanPrefix makes cutPrefix end with a slash
+func (p *page) cleanPrefix() {
+	if !strings.HasSuffix(p.cutPrefix, "/") && p.cutPrefix != "" {
+		p.cutPrefix += "/"
+	}
+}
+
 type Option func(*WebTerm)
 
 func WithCutPrefix(cutPrefix string) Option {
@@ -74,24 +117,58 @@ func WithLocalization(localization map[string]string) Option {
 	}
 }
 
+// WithExport enables or disables exporting the screen and scrollback
+// of live sessions through the "export" endpoint, it is enabled by default.
+// The server keeps a copy of the screen of each session while it is enabled.
+func WithExport(enable bool) Option {
+	return func(wt *WebTerm) {
+		wt.exportEnabled = enable
+	}
+}
+
+// WithShutdownNotice sets the message printed into every live terminal
+// when Shutdown is called.
+func WithShutdownNotice(notice string) Option {
+	return func(wt *WebTerm) {
+		wt.shutdownNotice = notice
+	}
+}
+
+const DefaultShutdownNotice = "The server is shutting down, the session will be closed."
+
 func New(runner Runner, opts ...Option) *WebTerm {
 	wt := &WebTerm{
-		runner:          runner,
-		fsServer:        http.FileServerFS(staticFS),
-		terminalOptions: DefaultTerminalOptions(),
+		page:           defaultPage(),
+		runner:         runner,
+		exportEnabled:  true,
+		shutdownNotice: DefaultShutdownNotice,
 	}
 	for _, opt := range opts {
 		opt(wt)
 	}
-	if !strings.HasSuffix(wt.cutPrefix, "/") && wt.cutPrefix != "" {
-		wt.cutPrefix += "/"
+	if wt.reg == nil {
+		wt.reg = newRegistry(wt.shareSecret)
 	}
+	wt.reg.limiter.setLimits(wt.limits)
+	wt.page.cleanPrefix()
 	return wt
 }
 
 //go:embed static/*
 var staticFS embed.FS
 
+var staticServer = http.FileServerFS(staticFS)
+
+// serveStatic serves the static file of path, the templates of the pages are not served
+func serveStatic(w http.ResponseWriter, r *http.Request, path string) {
+	if strings.HasPrefix(path, "index") || strings.HasPrefix(path, "broadcast") {
+		http.NotFound(w, r)
+		return
+	}
+	r.URL.Path = "static/" + path
+	staticServer.ServeHTTP(w, r)
+}
+
 var tmplIndex *template.Template
 
 func (wt *WebTerm) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -107,13 +184,10 @@ func (wt *WebTerm) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		wt.index(w, r)
 	case "data":
 		wt.data(w, r)
+	case "export":
+		wt.export(w, r)
 	default:
-		if strings.HasPrefix(path, "index") {
-			http.NotFound(w, r)
-			return
-		}
-		r.URL.Path = "static/" + path
-		wt.fsServer.ServeHTTP(w, r)
+		serveStatic(w, r, path)
 	}
 }
 
@@ -149,50 +223,215 @@ func (wt *WebTerm) index(w http.ResponseWriter, _ *http.Request) {
 	}
 }
 
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: func(r *http.Request) bool {
+		return true
+	},
+}
+
 func (wt *WebTerm) data(w http.ResponseWriter, r *http.Request) {
+	if !wt.acquire() {
+		http.Error(w, ErrShutdown.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	defer wt.reg.handlers.Done()
+	if token := r.URL.Query().Get("share"); token != "" {
+		wt.attachShared(w, r, token)
+		return
+	}
+	principal, err := wt.authenticate(r)
+	if err != nil {
+		slog.Warn("webterm authentication failed", "error", err, "remote", r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// from here on errors are reported in the terminal
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("websocket upgrade fail", "error", err)
+		return
+	}
+	defer conn.Close()
+	owner := newClient(conn, false, false)
+
+	ip := remoteIP(r)
+	release, err := wt.admit(owner, principal.Name, ip)
+	if err != nil {
+		slog.Warn("webterm session not admitted", "error", err, "principal", principal.Name, "remote", r.RemoteAddr)
+		owner.reject(err, websocket.CloseTryAgainLater)
+		return
+	}
+	defer release()
+
+	info := newSessionInfo(r, principal)
 	session, err := wt.runner.Session()
 	if err != nil {
 		slog.Error("webterm failed to create runner", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		wt.observers.each(func(o Observer) { o.SessionError(info, err) })
+		owner.reject(err, websocket.CloseInternalServerErr)
 		return
 	}
+	// before the middlewares, which hide the optional interfaces
+	if setter, ok := session.(SessionInfoSetter); ok {
+		setter.SetSessionInfo(info)
+	}
+	session = chainSession(session, wt.middleware)
+	wt.observers.each(func(o Observer) { o.SessionCreated(info) })
 	if err := session.Open(); err != nil {
 		slog.Error("webterm failed to run", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		wt.observers.each(func(o Observer) { o.SessionError(info, err) })
+		wt.observers.each(func(o Observer) { o.SessionClosed(info) })
+		owner.reject(err, websocket.CloseInternalServerErr)
 		return
 	}
 	defer session.Close()
+	wt.observers.each(func(o Observer) { o.SessionOpened(info) })
+	defer wt.observers.each(func(o Observer) { o.SessionClosed(info) })
 
-	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
-	}
-	conn, err := upgrader.Upgrade(w, r, nil)
+	ls, err := wt.register(session, info)
 	if err != nil {
-		slog.Error("websocket upgrade fail", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// the session is closed by the deferred Close
+		owner.reject(err, websocket.CloseServiceRestart)
+		return
 	}
-	defer conn.Close()
+	defer wt.unregister(ls)
+	if err := owner.writeEvent("session", sessionEvent{SessionInfo: ls.info, Macros: macroButtons(ls.macros)}); err != nil {
+		slog.Error("webterm failed to send session info", "error", err)
+		return
+	}
+	ls.attach(owner)
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		pumpStdout(conn, session)
+		pumpStdout(ls)
 	}()
-	pumpStdin(conn, session)
+	// the size of the data URL, sessions which took it from the info are already at this size
+	if info.Cols > 0 {
+		if err := session.SetWinSize(info.Cols, info.Rows); err != nil {
+			slog.Error("webterm failed to set window size", "error", err)
+		}
+	}
+	pumpStdin(owner, ls)
+	// the session ends with its owner, shared clients are disconnected by pumpStdout
+	session.Close()
 	wg.Wait()
 	slog.Info("webterm data closed")
 }
 
-func pumpStdin(ws *websocket.Conn, runner Session) {
-	defer func() {
-		ws.Close()
-		runner.Close()
-	}()
+// attachShared attaches the websocket to a live session with a share token
+func (wt *WebTerm) attachShared(w http.ResponseWriter, r *http.Request, token string) {
+	share, err := wt.verifyShare(token)
+	if err != nil {
+		slog.Warn("webterm share rejected", "error", err, "remote", r.RemoteAddr)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	ls := wt.lookup(share.SessionID)
+	if ls == nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		slog.Error("websocket upgrade fail", "error", err)
+		return
+	}
+	defer conn.Close()
+
+	c := newClient(conn, true, share.ReadOnly)
+	c.shareID = share.ID
+	evt := sessionEvent{ReadOnly: share.ReadOnly, ExpiresAt: share.ExpiresAt}
+	if !share.ReadOnly {
+		evt.Macros = macroButtons(ls.macros)
+	}
+	if err := c.writeEvent("session", evt); err != nil {
+		slog.Error("webterm failed to send session info", "error", err)
+		return
+	}
+	// disconnect when the share expires
+	expire := time.AfterFunc(time.Until(share.ExpiresAt), c.close)
+	defer expire.Stop()
+
+	ls.attach(c)
+	defer ls.detach(c)
+	slog.Info("webterm shared session attached", "session", ls.info.ID, "share", share.ID, "remote", r.RemoteAddr)
+	pumpStdin(c, ls)
+	slog.Info("webterm shared session detached", "session", ls.info.ID, "share", share.ID, "remote", r.RemoteAddr)
+}
+
+// export serves the screen and scrollback of a live session,
+// e.g. export?session=<id>&format=html|svg|text or export?share=<token>&format=html
+func (wt *WebTerm) export(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("session")
+	if token := r.URL.Query().Get("share"); token != "" {
+		share, err := wt.verifyShare(token)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		id = share.SessionID
+	}
+	format, err := ParseExportFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ls := wt.lookup(id)
+	if ls == nil {
+		http.Error(w, ErrSessionNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	if !r.URL.Query().Has("share") {
+		// only the owner exports by session ID
+		principal, err := wt.authenticate(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if principal.Name != ls.info.Principal.Name {
+			http.Error(w, ErrSessionNotFound.Error(), http.StatusNotFound)
+			return
+		}
+	}
+	if ls.screen == nil {
+		http.Error(w, ErrExportDisabled.Error(), http.StatusForbidden)
+		return
+	}
+	filename := fmt.Sprintf("webterm-%s-%s%s", id[:min(8, len(id))], time.Now().Format("20060102-150405"), format.Ext())
+	w.Header().Set("Content-Type", format.ContentType())
+	if r.URL.Query().Has("download") {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	}
+	if err := ls.screen.Export(w, format, wt.terminalOptions); err != nil {
+		slog.Error("webterm failed to export", "error", err)
+	}
+}
+
+// Event is a message from the server to the browser, it is sent as a
+// websocket text frame, while the terminal output is sent as binary frames.
+type Event struct {
+	Type string `json:"type"`
+	Data any    `json:"data,omitempty"`
+}
+
+// sessionEvent is the first event of a connection, clients attached with
+// a share token do not receive the session ID.
+type sessionEvent struct {
+	SessionInfo
+	ReadOnly  bool          `json:"readOnly,omitempty"`
+	ExpiresAt time.Time     `json:"expiresAt,omitzero"`
+	Macros    []macroButton `json:"macros,omitempty"`
+}
+
+func pumpStdin(c *client, ls *liveSession) {
+	runner := ls.session
+	defer c.close()
+	ws := c.conn
 	ws.SetReadLimit(8192)
 	for {
 		_, message, err := ws.ReadMessage()
@@ -207,29 +446,62 @@ func pumpStdin(ws *websocket.Conn, runner Session) {
 		data := message[1:]
 		switch op {
 		case 0: // Resize message
+			if c.guest {
+				// the window size follows the owner of the session
+				continue
+			}
 			sz := pty.Winsize{}
 			if err := json.Unmarshal(data, &sz); err != nil {
 				slog.Error("webterm failed to unmarshal resize message", "error", err)
 				continue
 			}
+			if !validWinSize(int(sz.Cols), int(sz.Rows)) {
+				slog.Error("webterm invalid window size", "cols", sz.Cols, "rows", sz.Rows)
+				continue
+			}
+			ls.mu.Lock()
+			ls.info.Cols, ls.info.Rows = int(sz.Cols), int(sz.Rows)
+			ls.mu.Unlock()
 			if err := runner.SetWinSize(int(sz.Cols), int(sz.Rows)); err != nil {
 				slog.Error("webterm failed to set window size", "error", err)
+				ls.observers.each(func(o Observer) { o.SessionError(ls.currentInfo(), err) })
+			}
+			ls.observers.each(func(o Observer) { o.SessionResized(ls.currentInfo(), int(sz.Cols), int(sz.Rows)) })
+			if ls.screen != nil {
+				ls.screen.Resize(int(sz.Cols), int(sz.Rows))
 			}
 		case 1: // Data message
+			if c.readOnly {
+				continue
+			}
+			ls.observers.each(func(o Observer) { o.SessionInput(ls.currentInfo(), data) })
 			if _, err := runner.Write(data); err != nil {
 				slog.Error("webterm failed to write to runner", "error", err)
+				ls.observers.each(func(o Observer) { o.SessionError(ls.currentInfo(), err) })
 				return
 			}
 		case 2: // Control message
+			if c.readOnly {
+				continue
+			}
+			ls.observers.each(func(o Observer) { o.SessionControl(ls.currentInfo(), data) })
+			if ls.macro(data) {
+				continue
+			}
 			if err := runner.Control(data); err != nil {
 				slog.Error("webterm failed to process control message", "error", err)
+				ls.observers.each(func(o Observer) { o.SessionError(ls.currentInfo(), err) })
 			}
 		}
 	}
 }
 
-func pumpStdout(ws *websocket.Conn, runner Session) {
-	defer ws.Close()
+// pumpStdout copies the output of the session to all attached clients,
+// until the session ends.
+func pumpStdout(ls *liveSession) {
+	runner := ls.session
+	// the session has ended, the clients see a normal closure
+	defer ls.closeClientsWith(websocket.CloseNormalClosure, "")
 	buffer := make([]byte, 8192)
 	for {
 		n, err := runner.Read(buffer)
@@ -237,10 +509,6 @@ func pumpStdout(ws *websocket.Conn, runner Session) {
 			slog.Error("webterm failed to read from runner", "error", err)
 			break
 		}
-		err = ws.WriteMessage(websocket.BinaryMessage, buffer[:n])
-		if err != nil {
-			slog.Error("webterm failed to write to websocket", "error", err)
-			break
-		}
+		ls.output(buffer[:n])
 	}
 }
@@ -0,0 +1,131 @@
+package webtermtest
+
+import (
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+)
+
+// TestSession checks that the sessions of newSession behave as WebTerm expects, e.g.
+//
+//	webtermtest.TestSession(t, runner.Session)
+//
+// WebTerm reads the output in its own goroutine while it writes the input,
+// resizes and sends control messages, and closes the session when the owner leaves.
+// Run it with -race to catch the data races between them.
+func TestSession(t *testing.T, newSession func() (webterm.Session, error)) {
+	open := func(t *testing.T) webterm.Session {
+		t.Helper()
+		s, err := newSession()
+		if err != nil {
+			t.Fatalf("Failed to create the session: %v", err)
+		}
+		if err := s.Open(); err != nil {
+			t.Fatalf("Failed to open the session: %v", err)
+		}
+		return s
+	}
+
+	t.Run("OpenClose", func(t *testing.T) {
+		s := open(t)
+		within(t, "Close", func() { s.Close() })
+	})
+
+	t.Run("CloseUnblocksRead", func(t *testing.T) {
+		s := open(t)
+		readDone := drain(s)
+		s.SetWinSize(80, 24)
+		time.Sleep(50 * time.Millisecond) // let Read block
+		within(t, "Close", func() { s.Close() })
+		within(t, "Read to return after Close", func() { <-readDone })
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		s := open(t)
+		readDone := drain(s)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				s.Write([]byte(" "))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				s.SetWinSize(80+i, 24+i)
+			}
+		}()
+		within(t, "Write and SetWinSize", wg.Wait)
+		within(t, "Close", func() { s.Close() })
+		within(t, "Read to return after Close", func() { <-readDone })
+	})
+
+	t.Run("InvalidControl", func(t *testing.T) {
+		s := open(t)
+		defer s.Close()
+		// an error is fine, a panic or a hang is not
+		within(t, "Control", func() { s.Control([]byte("\x00invalid")) })
+	})
+
+	t.Run("WriteAfterClose", func(t *testing.T) {
+		s := open(t)
+		within(t, "Close", func() { s.Close() })
+		within(t, "Write after Close", func() { s.Write([]byte("x")) })
+	})
+}
+
+// TestRunner serves the runner with a Harness and checks the life cycle of its sessions:
+// every connection gets a session of its own, which is closed when the connection is.
+func TestRunner(t *testing.T, runner webterm.Runner, opts ...webterm.Option) {
+	h := NewHarness(t, runner, opts...)
+
+	rsp, err := h.Server.Client().Get(h.Server.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to get the terminal page: %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != 200 {
+		t.Errorf("Expected the terminal page, got %s", rsp.Status)
+	}
+
+	first := h.Connect()
+	second := h.Connect()
+	if a, b := first.Session().ID, second.Session().ID; a == "" || a == b {
+		t.Errorf("Expected distinct session IDs, got %q and %q", a, b)
+	}
+	h.ExpectSessions(2)
+	first.Resize(100, 30)
+	first.Send(" ")
+	first.Close()
+	second.Close()
+	h.ExpectSessions(0)
+}
+
+func within(t *testing.T, what string, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(Timeout):
+		t.Fatalf("Expected %s to return within %s", what, Timeout)
+	}
+}
+
+// drain reads the session until Read fails, the returned channel is closed then
+func drain(s webterm.Session) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		io.Copy(io.Discard, s)
+	}()
+	return done
+}
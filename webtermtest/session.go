@@ -0,0 +1,255 @@
+package webtermtest
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+)
+
+var _ webterm.Runner = (*Runner)(nil)
+var _ webterm.Session = (*Session)(nil)
+
+// Timeout is how long the Expect functions wait before failing the test
+var Timeout = 5 * time.Second
+
+// Step is a step of the script of a fake Session
+type Step struct {
+	Expect string // the input to wait for before the output, none if empty
+	Output string
+	Exit   bool // end the session after the output, Read returns io.EOF
+}
+
+// Size is a window size set by SetWinSize
+type Size struct {
+	Cols int
+	Rows int
+}
+
+// Session is a fake webterm.Session playing a script.
+// It records the input, the window sizes and the control messages it receives.
+// After the last step Read blocks until the session is closed, unless the step exits.
+type Session struct {
+	OpenError error // returned by Open if set
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	script   []Step
+	step     int
+	exited   bool
+	input    []byte
+	matched  int // length of the input consumed by the steps
+	pending  []byte
+	sizes    []Size
+	controls []string
+	opened   bool
+	closed   bool
+}
+
+func NewSession(script ...Step) *Session {
+	s := &Session{script: script}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *Session) Open() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.OpenError != nil {
+		return s.OpenError
+	}
+	s.opened = true
+	return nil
+}
+
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.cond.Broadcast()
+	return nil
+}
+
+func (s *Session) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		if s.closed {
+			return 0, io.EOF
+		}
+		if len(s.pending) > 0 {
+			n := copy(p, s.pending)
+			s.pending = s.pending[n:]
+			return n, nil
+		}
+		if s.exited {
+			return 0, io.EOF
+		}
+		if s.step < len(s.script) {
+			st := s.script[s.step]
+			if st.Expect == "" {
+				s.next(st)
+				continue
+			}
+			if i := bytes.Index(s.input[s.matched:], []byte(st.Expect)); i >= 0 {
+				s.matched += i + len(st.Expect)
+				s.next(st)
+				continue
+			}
+		}
+		s.cond.Wait()
+	}
+}
+
+func (s *Session) next(st Step) {
+	s.pending = append(s.pending, st.Output...)
+	s.exited = st.Exit
+	s.step++
+}
+
+func (s *Session) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, io.ErrClosedPipe
+	}
+	s.input = append(s.input, p...)
+	s.cond.Broadcast()
+	return len(p), nil
+}
+
+func (s *Session) SetWinSize(cols, rows int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sizes = append(s.sizes, Size{Cols: cols, Rows: rows})
+	return nil
+}
+
+func (s *Session) Control(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.controls = append(s.controls, string(data))
+	return nil
+}
+
+// Input returns all the input written to the session
+func (s *Session) Input() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return string(s.input)
+}
+
+func (s *Session) Sizes() []Size {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Size(nil), s.sizes...)
+}
+
+func (s *Session) Controls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.controls...)
+}
+
+func (s *Session) Opened() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.opened
+}
+
+func (s *Session) Closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// ExpectInput waits until the input contains substr
+func (s *Session) ExpectInput(t testing.TB, substr string) {
+	t.Helper()
+	waitFor(t, func() bool { return strings.Contains(s.Input(), substr) }, func() string {
+		return fmt.Sprintf("input %q, got %q", substr, s.Input())
+	})
+}
+
+// ExpectSize waits until the last window size is cols x rows
+func (s *Session) ExpectSize(t testing.TB, cols, rows int) {
+	t.Helper()
+	last := func() Size {
+		if sizes := s.Sizes(); len(sizes) > 0 {
+			return sizes[len(sizes)-1]
+		}
+		return Size{}
+	}
+	waitFor(t, func() bool { return last() == Size{Cols: cols, Rows: rows} }, func() string {
+		return fmt.Sprintf("size %dx%d, got %+v", cols, rows, last())
+	})
+}
+
+// ExpectControl waits until the session received the control message
+func (s *Session) ExpectControl(t testing.TB, data string) {
+	t.Helper()
+	waitFor(t, func() bool { return slices.Contains(s.Controls(), data) }, func() string {
+		return fmt.Sprintf("control %q, got %q", data, s.Controls())
+	})
+}
+
+// ExpectClosed waits until the session is closed
+func (s *Session) ExpectClosed(t testing.TB) {
+	t.Helper()
+	waitFor(t, s.Closed, func() string { return "the session to be closed" })
+}
+
+// waitFor polls cond until Timeout, then fails the test with the expectation
+func waitFor(t testing.TB, cond func() bool, expected func() string) {
+	t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s", expected())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Runner is a fake webterm.Runner, each Session plays the Script
+type Runner struct {
+	Script []Step
+
+	mu       sync.Mutex
+	sessions []*Session
+}
+
+func (r *Runner) Session() (webterm.Session, error) {
+	s := NewSession(r.Script...)
+	r.mu.Lock()
+	r.sessions = append(r.sessions, s)
+	r.mu.Unlock()
+	return s, nil
+}
+
+func (r *Runner) Template() (*template.Template, any) {
+	return nil, nil
+}
+
+// Sessions returns the sessions created so far
+func (r *Runner) Sessions() []*Session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Session(nil), r.sessions...)
+}
+
+// ExpectSession waits until the runner created n sessions and returns the n-th one
+func (r *Runner) ExpectSession(t testing.TB, n int) *Session {
+	t.Helper()
+	waitFor(t, func() bool { return len(r.Sessions()) >= n }, func() string {
+		return fmt.Sprintf("%d sessions, got %d", n, len(r.Sessions()))
+	})
+	return r.Sessions()[n-1]
+}
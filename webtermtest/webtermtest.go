@@ -0,0 +1,229 @@
+// Package webtermtest provides utilities for testing Runner and Session implementations:
+// a scripted fake Session, a harness serving a Runner with httptest,
+// and a conformance suite for Sessions.
+package webtermtest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/OutOfBedlam/webterm/webclient"
+)
+
+// Harness serves a Runner through WebTerm.ServeHTTP on a httptest.Server.
+type Harness struct {
+	t      testing.TB
+	Term   *webterm.WebTerm
+	Server *httptest.Server
+}
+
+// NewHarness starts the server of the runner, it is closed when the test ends.
+// The options are the ones of webterm.New, the harness sets the cut prefix.
+func NewHarness(t testing.TB, runner webterm.Runner, opts ...webterm.Option) *Harness {
+	t.Helper()
+	wt := webterm.New(runner, append(opts, webterm.WithCutPrefix("/"))...)
+	srv := httptest.NewServer(wt)
+	t.Cleanup(srv.Close)
+	return &Harness{t: t, Term: wt, Server: srv}
+}
+
+// Connect opens a new session like the terminal page does
+func (h *Harness) Connect(opts ...webclient.Option) *Conn {
+	h.t.Helper()
+	return h.dial(h.Server.URL+"/data", opts)
+}
+
+// ConnectQuery connects with the query of the data URL, e.g. "command=psql", see SessionInfo.Query
+func (h *Harness) ConnectQuery(query string, opts ...webclient.Option) *Conn {
+	h.t.Helper()
+	return h.dial(h.Server.URL+"/data?"+query, opts)
+}
+
+// Attach connects to a live session with the token of a share link, see WebTerm.Share
+func (h *Harness) Attach(token string, opts ...webclient.Option) *Conn {
+	h.t.Helper()
+	return h.dial(h.Server.URL+"/data?share="+token, opts)
+}
+
+func (h *Harness) dial(url string, opts []webclient.Option) *Conn {
+	h.t.Helper()
+	c := &Conn{t: h.t, done: make(chan struct{})}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	client, err := webclient.Dial(ctx, url, append(opts, webclient.WithEventHandler(c.event))...)
+	if err != nil {
+		h.t.Fatalf("Failed to connect %s: %v", url, err)
+	}
+	c.client = client
+	h.t.Cleanup(func() { client.Close() })
+	go c.read()
+	return c
+}
+
+// ExpectSessions waits until the WebTerm has n live sessions
+func (h *Harness) ExpectSessions(n int) []webterm.SessionInfo {
+	h.t.Helper()
+	var sessions []webterm.SessionInfo
+	waitFor(h.t, func() bool {
+		sessions = h.Term.Sessions()
+		return len(sessions) == n
+	}, func() string {
+		return fmt.Sprintf("%d live sessions, got %d", n, len(sessions))
+	})
+	return sessions
+}
+
+// Conn is a websocket connection of the harness, its output is read in the background.
+// The methods fail the test on errors.
+type Conn struct {
+	t      testing.TB
+	client *webclient.Client
+	mu     sync.Mutex
+	out    bytes.Buffer
+	events []webclient.Event
+	done   chan struct{}
+	err    error
+}
+
+func (c *Conn) read() {
+	defer close(c.done)
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.client.Read(buf)
+		c.mu.Lock()
+		c.out.Write(buf[:n])
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				c.err = err
+			}
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+	}
+}
+
+func (c *Conn) event(evt webclient.Event) {
+	c.mu.Lock()
+	c.events = append(c.events, evt)
+	c.mu.Unlock()
+}
+
+// Client returns the underlying client
+func (c *Conn) Client() *webclient.Client {
+	return c.client
+}
+
+// Session returns the session event of the connection
+func (c *Conn) Session() webclient.SessionEvent {
+	c.t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	info, err := c.client.Session(ctx)
+	if err != nil {
+		c.t.Fatalf("Expected the session event: %v", err)
+	}
+	return info
+}
+
+// Send writes the input
+func (c *Conn) Send(input string) {
+	c.t.Helper()
+	if _, err := c.client.Write([]byte(input)); err != nil {
+		c.t.Fatalf("Failed to send %q: %v", input, err)
+	}
+}
+
+func (c *Conn) Resize(cols, rows int) {
+	c.t.Helper()
+	if err := c.client.Resize(cols, rows); err != nil {
+		c.t.Fatalf("Failed to resize: %v", err)
+	}
+}
+
+func (c *Conn) Control(data string) {
+	c.t.Helper()
+	if err := c.client.Control([]byte(data)); err != nil {
+		c.t.Fatalf("Failed to send control %q: %v", data, err)
+	}
+}
+
+func (c *Conn) RunMacro(name string) {
+	c.t.Helper()
+	if err := c.client.RunMacro(name); err != nil {
+		c.t.Fatalf("Failed to run macro %q: %v", name, err)
+	}
+}
+
+// Close closes the connection, which ends the session of its owner
+func (c *Conn) Close() {
+	c.client.Close()
+}
+
+// Output returns the output not consumed by ExpectOutput yet
+func (c *Conn) Output() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.out.String()
+}
+
+// ExpectOutput waits until the output contains substr and returns the output up to its end.
+// The returned output is consumed, the next calls look at the output after it.
+func (c *Conn) ExpectOutput(substr string) string {
+	c.t.Helper()
+	var consumed string
+	waitFor(c.t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if i := strings.Index(c.out.String(), substr); i >= 0 {
+			consumed = string(c.out.Next(i + len(substr)))
+			return true
+		}
+		return false
+	}, func() string {
+		return fmt.Sprintf("output %q, got %q", substr, c.Output())
+	})
+	return consumed
+}
+
+// ExpectEvent waits for a server event of the type, e.g. "title", and consumes it
+func (c *Conn) ExpectEvent(typ string) webclient.Event {
+	c.t.Helper()
+	var evt webclient.Event
+	waitFor(c.t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, e := range c.events {
+			if e.Type == typ {
+				evt = e
+				c.events = append(c.events[:i], c.events[i+1:]...)
+				return true
+			}
+		}
+		return false
+	}, func() string {
+		return fmt.Sprintf("a %q event", typ)
+	})
+	return evt
+}
+
+// ExpectClosed waits until the server closed the connection and returns the reason:
+// nil if the session ended normally, or a *websocket.CloseError, e.g. for session limits.
+func (c *Conn) ExpectClosed() error {
+	c.t.Helper()
+	select {
+	case <-c.done:
+	case <-time.After(Timeout):
+		c.t.Fatalf("Expected the connection to be closed, got output %q", c.Output())
+	}
+	return c.err
+}
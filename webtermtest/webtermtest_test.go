@@ -0,0 +1,89 @@
+package webtermtest
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/OutOfBedlam/webterm"
+	"github.com/OutOfBedlam/webterm/webclient"
+	"github.com/gorilla/websocket"
+)
+
+func TestScript(t *testing.T) {
+	s := NewSession(
+		Step{Output: "$ "},
+		Step{Expect: "ls\r", Output: "a b\r\n$ "},
+		Step{Expect: "exit\r", Output: "bye\r\n", Exit: true},
+	)
+	if err := s.Open(); err != nil {
+		t.Fatal(err)
+	}
+	go io.WriteString(s, "ls\rexit\r")
+	out, err := io.ReadAll(s)
+	if err != nil || string(out) != "$ a b\r\n$ bye\r\n" {
+		t.Errorf("Unexpected output %q %v", out, err)
+	}
+	if s.Input() != "ls\rexit\r" {
+		t.Errorf("Unexpected input %q", s.Input())
+	}
+}
+
+func TestHarness(t *testing.T) {
+	runner := &Runner{Script: []Step{
+		{Output: "$ "},
+		{Expect: "whoami\r", Output: "\x1b]0;shell\x07root\r\n$ "},
+	}}
+	h := NewHarness(t, runner, webterm.WithMacros(webterm.Macro{Name: "who", Text: "whoami\r"}))
+
+	c := h.Connect(webclient.WithSize(120, 40))
+	s := runner.ExpectSession(t, 1)
+	if !s.Opened() {
+		t.Errorf("Expected the session to be opened")
+	}
+	s.ExpectSize(t, 120, 40)
+	c.ExpectOutput("$ ")
+
+	c.RunMacro("who")
+	s.ExpectInput(t, "whoami\r")
+	if out := c.ExpectOutput("root\r\n$ "); out != "\x1b]0;shell\x07root\r\n$ " {
+		t.Errorf("Unexpected output %q", out)
+	}
+	c.ExpectEvent("title")
+
+	c.Resize(80, 24)
+	s.ExpectSize(t, 80, 24)
+	c.Control(`{"filter":"x"}`)
+	s.ExpectControl(t, `{"filter":"x"}`)
+
+	share, err := h.Term.Share(c.Session().ID, time.Minute, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest := h.Attach(share.Token)
+	guest.Send("ls\r")
+	s.ExpectInput(t, "ls\r")
+
+	c.Close()
+	s.ExpectClosed(t)
+	if err := guest.ExpectClosed(); err != nil {
+		t.Errorf("Expected the guest to be closed normally, got %v", err)
+	}
+	h.ExpectSessions(0)
+}
+
+func TestHarnessRejected(t *testing.T) {
+	h := NewHarness(t, &Runner{}, webterm.WithLimits(webterm.Limits{MaxSessions: 1}))
+	h.Connect()
+	h.ExpectSessions(1)
+	err := h.Connect().ExpectClosed()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("Expected the session limit close error, got %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	runner := &Runner{Script: []Step{{Output: "$ "}}}
+	TestSession(t, runner.Session)
+	TestRunner(t, runner)
+}